@@ -0,0 +1,68 @@
+package flatpack
+
+import (
+	"testing"
+)
+
+// For benchmarking a config of typical size and shape
+type benchmarked struct {
+	Name     string `flatpack:"required"`
+	Debug    bool
+	Level    string `flatpack:"default=info,oneof=debug|info|warn"`
+	Hosts    []string
+	Database struct {
+		Host     string
+		Port     int `flatpack:"default=5432,min=1,max=65535"`
+		User     string
+		Password Secret
+	}
+	Cache *struct {
+		Size    int
+		Timeout float64
+	}
+	Retries uint8
+	Ratio   float32
+}
+
+var benchmarkEnvironment = map[string]string{
+	"NAME":          "app",
+	"DEBUG":         "true",
+	"HOSTS":         `["a.example.com","b.example.com"]`,
+	"DATABASE_HOST": "db.example.com",
+	"DATABASE_USER": "app",
+	"CACHE_SIZE":    "1024",
+	"RETRIES":       "3",
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	it := New(stubEnvironment(benchmarkEnvironment))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		config := benchmarked{}
+		if err := it.Unmarshal(&config); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalSimple(b *testing.B) {
+	it := New(stubEnvironment(map[string]string{"FOO": "foo", "BAZ_BAR": "42", "QUUX": "[1,2,3]"}))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		fx := simple{}
+		if err := it.Unmarshal(&fx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalWithReport(b *testing.B) {
+	it := New(stubEnvironment(benchmarkEnvironment))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		config := benchmarked{}
+		if _, err := it.UnmarshalWithReport(&config); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package flatpack
+
+import (
+	"strconv"
+	"strings"
+)
+
+// TruthyWords and FalsyWords are the words that WithLenientBools accepts by
+// default, besides those that strconv.ParseBool accepts.
+var (
+	TruthyWords = []string{"yes", "y", "on", "enabled", "enable"}
+	FalsyWords  = []string{"no", "n", "off", "disabled", "disable"}
+)
+
+// WithLenientBools makes an Unmarshaller accept more words as boolean values
+// than the likes of true, false, 1 and 0, ignoring case and surrounding
+// space; e.g. DEBUG=yes or FEATURE_X=off. If truthy and falsy are both nil,
+// TruthyWords and FalsyWords are accepted.
+//
+// Generated UnmarshalFlatpack methods don't know these words, so Unmarshal
+// reflects instead of calling them.
+func WithLenientBools(truthy, falsy []string) Option {
+	if truthy == nil && falsy == nil {
+		truthy, falsy = TruthyWords, FalsyWords
+	}
+	words := make(map[string]bool, len(truthy)+len(falsy))
+	for _, word := range truthy {
+		words[strings.ToLower(word)] = true
+	}
+	for _, word := range falsy {
+		words[strings.ToLower(word)] = false
+	}
+	return func(f *implementation) {
+		f.bools = words
+	}
+}
+
+// Parse a boolean like strconv.ParseBool, also accepting the given words
+// (in lower case), if any.
+func parseBool(s string, words map[string]bool) (bool, error) {
+	boolean, err := strconv.ParseBool(s)
+	if err != nil && words != nil {
+		if word, ok := words[strings.ToLower(strings.TrimSpace(s))]; ok {
+			return word, nil
+		}
+	}
+	return boolean, err
+}
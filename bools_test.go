@@ -0,0 +1,42 @@
+package flatpack
+
+import (
+	"strconv"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type switches struct {
+	Debug   bool
+	Metrics bool
+	Flags   []bool
+}
+
+var _ = Describe("booleans", func() {
+	env := map[string]string{"DEBUG": "Yes", "METRICS": " off ", "FLAGS": `["on", "n", true]`}
+
+	It("are strict by default", func() {
+		err := New(stubEnvironment(env)).Unmarshal(&switches{})
+		Expect(err).To(HaveOccurred())
+		Expect(err.(Errors)).To(ContainElement(
+			&BadValue{Name: Key{"Debug"}, Cause: &strconv.NumError{Func: "ParseBool", Num: "Yes", Err: strconv.ErrSyntax}},
+		))
+	})
+
+	It("may be lenient", func() {
+		fx := switches{}
+		Expect(New(stubEnvironment(env), WithLenientBools(nil, nil)).Unmarshal(&fx)).To(Succeed())
+		Expect(fx).To(Equal(switches{Debug: true, Metrics: false, Flags: []bool{true, false, true}}))
+	})
+
+	It("may use other words", func() {
+		fx := switches{}
+		it := New(stubEnvironment(map[string]string{"DEBUG": "ja", "METRICS": "nein"}), WithLenientBools([]string{"Ja"}, []string{"nein"}))
+		Expect(it.Unmarshal(&fx)).To(Succeed())
+		Expect(fx.Debug).To(BeTrue())
+
+		err := New(stubEnvironment(map[string]string{"DEBUG": "yes"}), WithLenientBools([]string{"ja"}, nil)).Unmarshal(&fx)
+		Expect(err).To(MatchError(ContainSubstring("name=Debug")))
+	})
+})
@@ -0,0 +1,151 @@
+package flatpack
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache is a Getter that remembers the values returned by another Getter for
+// a limited time. It is useful when the underlying source is slow or remote
+// and several parts of an application unmarshal overlapping configuration.
+//
+// Missing values (the empty string) are cached just like present ones, so
+// repeated lookups of an absent key do not hit the underlying source. Errors
+// are never cached.
+//
+// A Cache is safe for concurrent use by multiple goroutines. To cache the
+// package-level data source:
+//
+//	flatpack.DataSource = flatpack.NewCache(flatpack.DataSource, time.Minute)
+type Cache struct {
+	source Getter
+	ttl    time.Duration
+	now    func() time.Time
+
+	lock    sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value   string
+	set     bool
+	expires time.Time
+}
+
+// NewCache returns a Cache that wraps source and retains each value for ttl.
+// A ttl of zero or less means that values never expire unless they are
+// explicitly invalidated.
+func NewCache(source Getter, ttl time.Duration) *Cache {
+	return &Cache{
+		source:  source,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]cacheEntry{},
+	}
+}
+
+// Get returns the cached value for name if it has not expired; otherwise it
+// reads the value from the underlying source and caches it.
+func (c *Cache) Get(name Key) (string, error) {
+	value, _, err := c.Lookup(name)
+	return value, err
+}
+
+// Lookup implements Lookuper by caching whether values of the underlying
+// source are set, too.
+func (c *Cache) Lookup(name Key) (string, bool, error) {
+	return c.get(cacheID(name), func() (string, bool, error) {
+		return lookup(c.source, name)
+	})
+}
+
+// GetProfile implements ProfileGetter by caching the profile-specific values
+// of the underlying source.
+func (c *Cache) GetProfile(profile string, name Key) (string, error) {
+	value, _, err := c.lookupProfile(profile, name)
+	return value, err
+}
+
+func (c *Cache) lookupProfile(profile string, name Key) (string, bool, error) {
+	return c.get(profile+"\x01"+cacheID(name), func() (string, bool, error) {
+		return lookupProfile(c.source, profile, name)
+	})
+}
+
+// Return the cached value with the given id if it has not expired;
+// otherwise call fetch and cache its result.
+func (c *Cache) get(id string, fetch func() (string, bool, error)) (string, bool, error) {
+	c.lock.Lock()
+	entry, ok := c.entries[id]
+	c.lock.Unlock()
+	if ok && (c.ttl <= 0 || c.now().Before(entry.expires)) {
+		return entry.value, entry.set, nil
+	}
+
+	value, set, err := fetch()
+	if err != nil {
+		return "", false, err
+	}
+
+	c.lock.Lock()
+	c.entries[id] = cacheEntry{value: value, set: set, expires: c.now().Add(c.ttl)}
+	c.lock.Unlock()
+
+	return value, set, nil
+}
+
+// Invalidate discards the cached value for name, if any, so that the next
+// call to Get consults the underlying source. Profile-specific values are
+// not affected; use InvalidateAll to discard those.
+func (c *Cache) Invalidate(name Key) {
+	c.lock.Lock()
+	delete(c.entries, cacheID(name))
+	c.lock.Unlock()
+}
+
+// InvalidateAll discards every cached value.
+func (c *Cache) InvalidateAll() {
+	c.lock.Lock()
+	c.entries = map[string]cacheEntry{}
+	c.lock.Unlock()
+}
+
+// Describe implements Describer by asking the underlying source.
+func (c *Cache) Describe(name Key) string {
+	return describe(c.source, name)
+}
+
+// Changes implements Watchable. If the underlying source is Watchable, its
+// notifications are forwarded; otherwise the cache reports a possible change
+// every WatchInterval. Either way, every cached value is discarded first, so
+// that the change can be seen however long the TTL is.
+func (c *Cache) Changes(ctx context.Context) <-chan struct{} {
+	var upstream <-chan struct{}
+	if watchable, ok := c.source.(Watchable); ok {
+		upstream = watchable.Changes(ctx)
+	} else {
+		upstream = poll(ctx, WatchInterval)
+	}
+
+	changes := make(chan struct{})
+	go func() {
+		defer close(changes)
+		for range upstream {
+			c.InvalidateAll()
+			select {
+			case changes <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return changes
+}
+
+// Compute a map key that uniquely identifies a Key. Key.String() is not
+// suitable because field names may themselves contain dots.
+func cacheID(name Key) string {
+	return strings.Join(name, "\x00")
+}
@@ -0,0 +1,132 @@
+package flatpack
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// A Getter that counts how many times each key was requested.
+type countingGetter struct {
+	lock   sync.Mutex
+	source Getter
+	calls  map[string]int
+	err    error
+}
+
+func (cg *countingGetter) Get(name Key) (string, error) {
+	cg.lock.Lock()
+	cg.calls[name.AsEnv()]++
+	cg.lock.Unlock()
+	if cg.err != nil {
+		return "", cg.err
+	}
+	return cg.source.Get(name)
+}
+
+// A Lookuper that looks values up in the environment of a countingGetter.
+type lookupGetter struct {
+	*countingGetter
+}
+
+func (lg lookupGetter) Lookup(name Key) (string, bool, error) {
+	if _, err := lg.Get(name); err != nil {
+		return "", false, err
+	}
+	return lg.source.(Lookuper).Lookup(name)
+}
+
+var _ = Describe("Cache", func() {
+	var counter *countingGetter
+	var cache *Cache
+	var clock time.Time
+
+	BeforeEach(func() {
+		counter = &countingGetter{
+			source: stubEnvironment(map[string]string{"FOO": "foo"}),
+			calls:  map[string]int{},
+		}
+		cache = NewCache(counter, time.Minute)
+		clock = time.Unix(0, 0)
+		cache.now = func() time.Time { return clock }
+	})
+
+	It("caches present values", func() {
+		Expect(cache.Get(Key{"Foo"})).To(Equal("foo"))
+		Expect(cache.Get(Key{"Foo"})).To(Equal("foo"))
+		Expect(counter.calls["FOO"]).To(Equal(1))
+	})
+
+	It("caches missing values", func() {
+		Expect(cache.Get(Key{"Bar"})).To(Equal(""))
+		Expect(cache.Get(Key{"Bar"})).To(Equal(""))
+		Expect(counter.calls["BAR"]).To(Equal(1))
+	})
+
+	It("expires values after the TTL", func() {
+		cache.Get(Key{"Foo"})
+		clock = clock.Add(time.Minute)
+		cache.Get(Key{"Foo"})
+		Expect(counter.calls["FOO"]).To(Equal(2))
+	})
+
+	It("supports invalidation", func() {
+		cache.Get(Key{"Foo"})
+		cache.Get(Key{"Bar"})
+		cache.Invalidate(Key{"Foo"})
+		cache.Get(Key{"Foo"})
+		cache.Get(Key{"Bar"})
+		Expect(counter.calls["FOO"]).To(Equal(2))
+		Expect(counter.calls["BAR"]).To(Equal(1))
+
+		cache.InvalidateAll()
+		cache.Get(Key{"Bar"})
+		Expect(counter.calls["BAR"]).To(Equal(2))
+	})
+
+	It("caches whether values are set", func() {
+		source := &countingGetter{source: stubEnvironment(map[string]string{"EMPTY": ""}), calls: map[string]int{}}
+		cache := NewCache(lookupGetter{source}, 0)
+		for i := 0; i < 2; i++ {
+			value, ok, err := cache.Lookup(Key{"Empty"})
+			Expect(value, err).To(Equal(""))
+			Expect(ok).To(BeTrue())
+			_, ok, _ = cache.Lookup(Key{"Missing"})
+			Expect(ok).To(BeFalse())
+		}
+		Expect(source.calls).To(Equal(map[string]int{"EMPTY": 1, "MISSING": 1}))
+	})
+
+	It("does not cache errors", func() {
+		counter.err = errors.New("unavailable")
+		_, err := cache.Get(Key{"Foo"})
+		Expect(err).To(HaveOccurred())
+		counter.err = nil
+		Expect(cache.Get(Key{"Foo"})).To(Equal("foo"))
+		Expect(counter.calls["FOO"]).To(Equal(2))
+	})
+
+	It("is safe for concurrent use", func() {
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(cache.Get(Key{"Foo"})).To(Equal("foo"))
+				cache.Invalidate(Key{"Bar"})
+			}()
+		}
+		wg.Wait()
+	})
+
+	It("works as an Unmarshal data source", func() {
+		it := implementation{source: cache}
+		fx := simple{}
+		Expect(it.Unmarshal(&fx)).To(Succeed())
+		Expect(fx.Foo).To(Equal("foo"))
+	})
+})
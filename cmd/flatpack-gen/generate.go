@@ -0,0 +1,931 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xeger/flatpack"
+)
+
+// Kinds of type that generated code knows how to read.
+type kind int
+
+const (
+	kindString kind = iota
+	kindBool
+	kindInt
+	kindUint
+	kindFloat
+	kindSlice
+	kindStruct
+	kindPtr
+)
+
+// Go types to which strconv parses each scalar kind.
+var parsed = map[kind]string{
+	kindString: "string",
+	kindBool:   "bool",
+	kindInt:    "int64",
+	kindUint:   "uint64",
+	kindFloat:  "float64",
+}
+
+// A type that appears in a config struct.
+type typeInfo struct {
+	kind kind
+	// expr is the Go syntax for the type
+	expr string
+	// bits is the size of numbers, or 0 if they are the size of an int
+	bits int
+	// named means the type is declared in the package or imported from
+	// another, so it may have a Validate method
+	named bool
+	// secret means the type is flatpack.Secret
+	secret bool
+	// elem is the element type of slices and pointers
+	elem *typeInfo
+	// fields are the fields of structs
+	fields []fieldInfo
+}
+
+func (t *typeInfo) isScalar() bool {
+	return t.kind <= kindFloat
+}
+
+// Determine whether a type holds secrets on its own account, like
+// flatpack.isSecretType.
+func (t *typeInfo) isSecret() bool {
+	for t.kind == kindPtr || t.kind == kindSlice {
+		t = t.elem
+	}
+	return t.secret
+}
+
+// A field of a config struct.
+type fieldInfo struct {
+	name string
+	typ  *typeInfo
+	tags tags
+	// promoted means the field is an embedded struct or pointer to struct
+	// whose fields are promoted, like flatpack.promoted
+	promoted bool
+}
+
+// Return the struct type whose fields are promoted through a field.
+func (f *fieldInfo) embedded() *typeInfo {
+	if f.typ.kind == kindPtr {
+		return f.typ.elem
+	}
+	return f.typ
+}
+
+// The options of a flatpack field tag that matter to generated code.
+type tags struct {
+	ignore, required, hasDefault, secret, prefix, ignoreEmpty bool
+	bytes, percent                                            bool
+	def                                                       string
+	rules                                                     []flatpack.TagOption
+}
+
+var builtins = map[string]typeInfo{
+	"string":  {kind: kindString},
+	"bool":    {kind: kindBool},
+	"int":     {kind: kindInt},
+	"int8":    {kind: kindInt, bits: 8},
+	"int16":   {kind: kindInt, bits: 16},
+	"int32":   {kind: kindInt, bits: 32},
+	"rune":    {kind: kindInt, bits: 32},
+	"int64":   {kind: kindInt, bits: 64},
+	"uint":    {kind: kindUint},
+	"uint8":   {kind: kindUint, bits: 8},
+	"byte":    {kind: kindUint, bits: 8},
+	"uint16":  {kind: kindUint, bits: 16},
+	"uint32":  {kind: kindUint, bits: 32},
+	"uint64":  {kind: kindUint, bits: 64},
+	"uintptr": {kind: kindUint},
+	"float32": {kind: kindFloat, bits: 32},
+	"float64": {kind: kindFloat, bits: 64},
+}
+
+// A type declaration and the file in which it appears.
+type decl struct {
+	spec *ast.TypeSpec
+	file *ast.File
+}
+
+// An error that pinpoints the field that caused it.
+type fieldError struct {
+	pos  token.Position
+	name string
+	err  error
+}
+
+func (e *fieldError) Error() string {
+	return fmt.Sprintf("%s: field %s: %s", e.pos, e.name, e.err)
+}
+
+type generator struct {
+	fset      *token.FileSet
+	decls     map[string]decl
+	resolving map[string]bool
+	buf       bytes.Buffer
+	strconv   bool
+	// importer loads the packages from which types are imported, once
+	// there is one
+	importer types.ImporterFrom
+	// imports maps the names under which generated code refers to other
+	// packages to those packages
+	imports map[string]*types.Package
+}
+
+// Generate the source of a file that declares UnmarshalFlatpack methods for
+// the named struct types, which must be declared in files.
+func generate(fset *token.FileSet, files []*ast.File, typeNames []string) ([]byte, error) {
+	g := &generator{fset: fset, decls: map[string]decl{}, resolving: map[string]bool{}, imports: map[string]*types.Package{}}
+	for _, file := range files {
+		for _, d := range file.Decls {
+			if gen, ok := d.(*ast.GenDecl); ok && gen.Tok == token.TYPE {
+				for _, spec := range gen.Specs {
+					spec := spec.(*ast.TypeSpec)
+					g.decls[spec.Name.Name] = decl{spec, file}
+				}
+			}
+		}
+	}
+
+	for _, name := range typeNames {
+		d, ok := g.decls[name]
+		if !ok {
+			return nil, fmt.Errorf("type %s not found", name)
+		}
+		t, err := g.resolve(d.spec.Name, d.file)
+		if err != nil {
+			return nil, err
+		}
+		if t.kind != kindStruct {
+			return nil, fmt.Errorf("type %s is not a struct", name)
+		}
+		g.method(name, t)
+	}
+
+	src := bytes.Buffer{}
+	fmt.Fprintf(&src, "// Code generated by flatpack-gen; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "package %s\n\n", files[0].Name.Name)
+	fmt.Fprintf(&src, "import (\n")
+	if g.strconv {
+		fmt.Fprintf(&src, "\"strconv\"\n")
+	}
+	names := make([]string, 0, len(g.imports))
+	for name := range g.imports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if pkg := g.imports[name]; pkg.Name() == name {
+			fmt.Fprintf(&src, "%q\n", pkg.Path())
+		} else {
+			fmt.Fprintf(&src, "%s %q\n", name, pkg.Path())
+		}
+	}
+	fmt.Fprintf(&src, "\n\"github.com/xeger/flatpack\"\n)\n\n")
+	src.Write(g.buf.Bytes())
+	return format.Source(src.Bytes())
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// Work out what a type expression means to flatpack. Fail if flatpack can't
+// read values of the type.
+func (g *generator) resolve(expr ast.Expr, file *ast.File) (*typeInfo, error) {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return g.resolve(e.X, file)
+	case *ast.Ident:
+		if builtin, ok := builtins[e.Name]; ok {
+			builtin.expr = e.Name
+			return &builtin, nil
+		}
+		d, ok := g.decls[e.Name]
+		if !ok || d.spec.TypeParams != nil {
+			break
+		}
+		if g.resolving[e.Name] {
+			return nil, fmt.Errorf("recursive type %s", e.Name)
+		}
+		g.resolving[e.Name] = true
+		defer delete(g.resolving, e.Name)
+		t, err := g.resolve(d.spec.Type, d.file)
+		if err != nil {
+			return nil, err
+		}
+		named := *t
+		named.expr = e.Name
+		if !d.spec.Assign.IsValid() {
+			named.named, named.secret = true, false
+		}
+		return &named, nil
+	case *ast.SelectorExpr:
+		pkg, ok := e.X.(*ast.Ident)
+		if !ok {
+			break
+		}
+		if isFlatpack(file, pkg.Name) {
+			if e.Sel.Name == "Secret" {
+				return &typeInfo{kind: kindString, expr: "flatpack.Secret", secret: true}, nil
+			}
+			break
+		}
+		obj, err := g.lookup(pkg.Name, e.Sel.Name, file)
+		if err != nil {
+			return nil, err
+		}
+		// types with a scalar underlying type, such as time.Duration, are
+		// read like that type
+		if basic, ok := obj.Type().Underlying().(*types.Basic); ok && obj.Exported() {
+			if builtin, ok := builtins[basic.Name()]; ok {
+				builtin.expr = pkg.Name + "." + e.Sel.Name
+				builtin.named = true
+				g.imports[pkg.Name] = obj.Pkg()
+				return &builtin, nil
+			}
+		}
+	case *ast.StarExpr:
+		elem, err := g.resolve(e.X, file)
+		if err != nil {
+			return nil, err
+		}
+		return &typeInfo{kind: kindPtr, expr: "*" + elem.expr, elem: elem}, nil
+	case *ast.ArrayType:
+		if e.Len != nil {
+			break
+		}
+		elem, err := g.resolve(e.Elt, file)
+		if err != nil {
+			return nil, err
+		}
+		if !elem.isScalar() && !(elem.kind == kindPtr && elem.elem.isScalar()) {
+			break
+		}
+		return &typeInfo{kind: kindSlice, expr: "[]" + elem.expr, elem: elem}, nil
+	case *ast.StructType:
+		fields, err := g.structFields(e, file)
+		if err != nil {
+			return nil, err
+		}
+		return &typeInfo{kind: kindStruct, expr: g.print(e), fields: fields}, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", g.print(expr))
+}
+
+// Determine whether flatpack skips fields of a type even without the ignore
+// tag, like flatpack.canIgnore: interfaces, channels and functions.
+func (g *generator) skipped(expr ast.Expr, file *ast.File) bool {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return g.skipped(e.X, file)
+	case *ast.InterfaceType, *ast.ChanType, *ast.FuncType:
+		return true
+	case *ast.Ident:
+		if e.Name == "any" || e.Name == "error" {
+			return true
+		}
+		if d, ok := g.decls[e.Name]; ok && !g.resolving[e.Name] {
+			g.resolving[e.Name] = true
+			defer delete(g.resolving, e.Name)
+			return g.skipped(d.spec.Type, d.file)
+		}
+	case *ast.SelectorExpr:
+		if pkg, ok := e.X.(*ast.Ident); ok && !isFlatpack(file, pkg.Name) {
+			// if the type can't be found, resolve says so
+			if obj, err := g.lookup(pkg.Name, e.Sel.Name, file); err == nil {
+				switch obj.Type().Underlying().(type) {
+				case *types.Interface, *types.Chan, *types.Signature:
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Find a type declared in another package, which file imports as pkg.
+func (g *generator) lookup(pkg, name string, file *ast.File) (*types.TypeName, error) {
+	if g.importer == nil {
+		g.importer = importer.ForCompiler(g.fset, "source", nil).(types.ImporterFrom)
+	}
+	dir := filepath.Dir(g.fset.Position(file.Pos()).Filename)
+
+	// The name of a package is usually the last element of its path, maybe
+	// followed by a version, as in gopkg.in/yaml.v3. Try the imports whose
+	// paths look like that first, and load the others only if need be.
+	type candidate struct {
+		path  string
+		named bool
+	}
+	var likely, unlikely []candidate
+	for _, imp := range file.Imports {
+		importPath, _ := strconv.Unquote(imp.Path.Value)
+		base := path.Base(importPath)
+		switch {
+		case imp.Name != nil && imp.Name.Name == pkg:
+			likely = append(likely, candidate{importPath, true})
+		case imp.Name != nil:
+		case base == pkg || strings.HasPrefix(base, pkg+"."):
+			likely = append(likely, candidate{importPath, false})
+		default:
+			unlikely = append(unlikely, candidate{importPath, false})
+		}
+	}
+	for i, c := range append(likely, unlikely...) {
+		p, err := g.importer.ImportFrom(c.path, dir, 0)
+		if err != nil && i < len(likely) {
+			return nil, err
+		} else if err != nil || !c.named && p.Name() != pkg {
+			continue
+		}
+		if other, ok := g.imports[pkg]; ok && other.Path() != c.path {
+			return nil, fmt.Errorf("%s refers to both %s and %s", pkg, other.Path(), c.path)
+		}
+		if obj, ok := p.Scope().Lookup(name).(*types.TypeName); ok {
+			return obj, nil
+		}
+		return nil, fmt.Errorf("%s.%s is not a type", pkg, name)
+	}
+	return nil, fmt.Errorf("unsupported type %s.%s; package %s isn't imported", pkg, name, pkg)
+}
+
+// Work out which fields of a struct flatpack reads, like flatpack.fieldsOf.
+func (g *generator) structFields(st *ast.StructType, file *ast.File) ([]fieldInfo, error) {
+	var fields []fieldInfo
+	for _, field := range st.Fields.List {
+		names := make([]string, 0, len(field.Names))
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+		if len(names) == 0 {
+			names = append(names, embeddedName(field.Type))
+		}
+		fail := func(err error) error {
+			if _, ok := err.(*fieldError); ok {
+				return err
+			}
+			return &fieldError{pos: g.fset.Position(field.Pos()), name: names[0], err: err}
+		}
+
+		tags, err := parseTags(field.Tag)
+		if err != nil {
+			return nil, fail(err)
+		}
+		if tags.ignore || g.skipped(field.Type, file) {
+			continue
+		}
+		t, err := g.resolve(field.Type, file)
+		if err == nil && len(field.Names) == 0 && !tags.prefix {
+			promoted := fieldInfo{name: names[0], typ: t, tags: tags, promoted: true}
+			if embedded := promoted.embedded(); embedded.kind == kindStruct {
+				if t.kind == kindPtr && !ast.IsExported(names[0]) {
+					return nil, fail(fmt.Errorf(`unexported embedded pointer; mark it with flatpack:"ignore"`))
+				}
+				fields = append(fields, promoted)
+				continue
+			}
+		}
+		for _, name := range names {
+			if !ast.IsExported(name) {
+				return nil, fail(fmt.Errorf(`unexported field; mark it with flatpack:"ignore"`))
+			}
+		}
+		if err != nil {
+			return nil, fail(err)
+		}
+		if err := checkUnits(t, tags); err != nil {
+			return nil, fail(err)
+		}
+		tags.secret = tags.secret || t.isSecret()
+		for _, name := range names {
+			fields = append(fields, fieldInfo{name: name, typ: t, tags: tags})
+		}
+	}
+	return fields, nil
+}
+
+// Make sure that the type of a field with the bytes or percent tag can hold
+// what they read, like implementation.decodeBytes and decodePercent.
+func checkUnits(t *typeInfo, tags tags) error {
+	for t.kind == kindPtr || t.kind == kindSlice {
+		t = t.elem
+	}
+	switch {
+	case tags.bytes && t.kind != kindInt && t.kind != kindUint && t.kind != kindFloat:
+		return fmt.Errorf("bytes needs a numeric field")
+	case tags.percent && t.kind != kindFloat:
+		return fmt.Errorf("percent needs a floating-point field")
+	}
+	return nil
+}
+
+// Parse the flatpack tag of a field.
+func parseTags(lit *ast.BasicLit) (tags, error) {
+	var result tags
+	if lit == nil {
+		return result, nil
+	}
+	tag, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return result, err
+	}
+	options, err := flatpack.ParseTag(reflect.StructTag(tag).Get("flatpack"))
+	if err != nil {
+		return result, fmt.Errorf("malformed field tag; %s", err)
+	}
+	for _, option := range options {
+		switch option.Name {
+		case "ignore":
+			result.ignore = true
+		case "required":
+			result.required = true
+		case "default":
+			result.hasDefault = true
+			result.def = option.Value
+		case "desc":
+		case "secret":
+			result.secret = true
+		case "prefix":
+			result.prefix = true
+		case "ignoreempty":
+			result.ignoreEmpty = true
+		case "bytes":
+			result.bytes = true
+		case "percent":
+			result.percent = true
+		case "json", "alias", "deprecated":
+			return result, fmt.Errorf("the %s tag isn't supported yet", option.Name)
+		default:
+			result.rules = append(result.rules, option)
+		}
+	}
+	return result, nil
+}
+
+// Determine the name of an embedded field.
+func embeddedName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(e.X)
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+// Determine whether name refers to the flatpack package in file.
+func isFlatpack(file *ast.File, name string) bool {
+	for _, imp := range file.Imports {
+		if path, _ := strconv.Unquote(imp.Path.Value); path == "github.com/xeger/flatpack" {
+			return imp.Name == nil && name == "flatpack" || imp.Name != nil && imp.Name.Name == name
+		}
+	}
+	return false
+}
+
+func (g *generator) print(expr ast.Expr) string {
+	buf := bytes.Buffer{}
+	printer.Fprint(&buf, g.fset, expr)
+	return buf.String()
+}
+
+// Emit the UnmarshalFlatpack method of a struct type.
+func (g *generator) method(name string, t *typeInfo) {
+	g.printf("// UnmarshalFlatpack implements flatpack.GeneratedUnmarshaller.\n")
+	g.printf("func (c *%s) UnmarshalFlatpack(source flatpack.Getter) error {\n", name)
+	g.printf("fs := flatpack.NewFields(source)\n")
+	g.fields(t, "c", nil)
+	g.printf("if fs.Failures() == 0 {\n")
+	g.printf("fs.Fail(fs.Validate(flatpack.Key{}, c), \"\", false)\n")
+	g.printf("}\n")
+	g.printf("return fs.Err()\n")
+	g.printf("}\n\n")
+}
+
+// Emit code that reads the fields of a struct; base is an expression that
+// denotes the struct.
+func (g *generator) fields(t *typeInfo, base string, prefix []string) {
+	g.fieldList(visible(t.fields), base, prefix)
+}
+
+// Emit code that reads fields, including promoted ones, which have no key
+// segment of their own.
+func (g *generator) fieldList(fields []fieldInfo, base string, prefix []string) {
+	for _, field := range fields {
+		target := base + "." + field.name
+		if !field.promoted {
+			key := append(prefix[:len(prefix):len(prefix)], field.name)
+			g.read(field.typ, field.tags, target, "&"+target, key)
+			continue
+		}
+		if field.typ.kind == kindStruct {
+			g.fieldList(field.typ.fields, target, prefix)
+			continue
+		}
+		// an embedded pointer is kept only if a value was read through it
+		g.printf("{\n")
+		g.printf("if %s == nil {\n", target)
+		g.printf("%s = new(%s)\n", target, field.typ.elem.expr)
+		g.printf("}\n")
+		g.printf("count := fs.Counted()\n")
+		g.fieldList(field.typ.elem.fields, target, prefix)
+		g.printf("if fs.Counted() == count {\n")
+		g.printf("%s = nil\n", target)
+		g.printf("}\n")
+		g.printf("}\n")
+	}
+}
+
+// Hide promoted fields like flatpack.fieldsOf: a field is visible if it is
+// the only one of its name at the shallowest depth at which the name occurs.
+// Return the fields of a struct with invisible fields, and embedded structs
+// that have no visible fields, removed.
+func visible(fields []fieldInfo) []fieldInfo {
+	shallowest, count := map[string]int{}, map[string]int{}
+	var tally func(fields []fieldInfo, depth int)
+	tally = func(fields []fieldInfo, depth int) {
+		for i := range fields {
+			field := &fields[i]
+			if field.promoted {
+				tally(field.embedded().fields, depth+1)
+			} else if d, ok := shallowest[field.name]; !ok || depth < d {
+				shallowest[field.name], count[field.name] = depth, 1
+			} else if depth == d {
+				count[field.name]++
+			}
+		}
+	}
+	tally(fields, 0)
+
+	var prune func(fields []fieldInfo, depth int) []fieldInfo
+	prune = func(fields []fieldInfo, depth int) []fieldInfo {
+		result := make([]fieldInfo, 0, len(fields))
+		for _, field := range fields {
+			if field.promoted {
+				embedded := *field.embedded()
+				embedded.fields = prune(embedded.fields, depth+1)
+				if len(embedded.fields) == 0 {
+					continue
+				}
+				if field.typ.kind == kindPtr {
+					ptr := *field.typ
+					ptr.elem = &embedded
+					field.typ = &ptr
+				} else {
+					field.typ = &embedded
+				}
+			} else if depth != shallowest[field.name] || count[field.name] != 1 {
+				continue
+			}
+			result = append(result, field)
+		}
+		return result
+	}
+	return prune(fields, 0)
+}
+
+// Emit code that reads a value into target, like implementation.read; addr
+// is an expression for the address of target.
+func (g *generator) read(t *typeInfo, tags tags, target, addr string, key []string) {
+	g.printf("{\n")
+	switch t.kind {
+	case kindString, kindBool, kindInt, kindUint, kindFloat:
+		g.get(t, tags, key)
+		g.printf("fs.Count(1)\n")
+		g.parse(t, tags, target, "got", func(err string) {
+			g.printf("fs.Fail(%s, got, %t)\n", err, tags.secret)
+		}, func() {
+			g.printf("%s", g.checks(t, tags, target, addr))
+		})
+		g.printf("}\n")
+	case kindSlice:
+		g.get(t, tags, key)
+		g.printf("fs.Count(1)\n")
+		g.printf("if elems, err := fs.Elements(got); err != nil {\n")
+		g.printf("fs.Fail(err, got, %t)\n", tags.secret)
+		g.printf("} else {\n")
+		g.printf("%s = make(%s, len(elems))\n", target, t.expr)
+		elem, elemTarget := t.elem, paren(target)+"[i]"
+		if elem.kind == kindPtr {
+			elem = elem.elem
+		}
+		checks := g.checks(t, tags, target, addr)
+		failable := elem.kind != kindString && checks != ""
+		if failable {
+			g.printf("failed := false\n")
+		}
+		g.printf("for i, elem := range elems {\n")
+		if elem != t.elem {
+			g.printf("%s = new(%s)\n", elemTarget, elem.expr)
+			elemTarget = "*" + elemTarget
+		}
+		g.parse(elem, tags, elemTarget, "elem", func(err string) {
+			g.printf("fs.Fail(%s, got, %t)\n", err, tags.secret)
+			if failable {
+				g.printf("failed = true\n")
+			}
+			g.printf("break\n")
+		}, func() {})
+		g.printf("}\n")
+		if failable {
+			g.printf("if !failed {\n%s}\n", checks)
+		} else {
+			g.printf("%s", checks)
+		}
+		g.printf("}\n")
+		g.printf("}\n")
+	case kindStruct:
+		if tags.required {
+			g.printf("count := fs.Counted()\n")
+		}
+		if tags.required || t.named {
+			g.printf("failures := fs.Failures()\n")
+		}
+		g.fields(t, selector(target, addr), key)
+		if tags.required || t.named {
+			g.printf("if fs.Failures() == failures {\n")
+			switch {
+			case tags.required && t.named:
+				g.printf("if fs.Counted() == count {\n")
+				g.missing(key)
+				g.printf("} else {\n")
+				g.validate(key, addr)
+				g.printf("}\n")
+			case tags.required:
+				g.printf("if fs.Counted() == count {\n")
+				g.missing(key)
+				g.printf("}\n")
+			default:
+				g.validate(key, addr)
+			}
+			g.printf("}\n")
+		}
+	case kindPtr:
+		elem, elemTarget := t.elem, "*"+target
+		g.printf("if %s == nil {\n", target)
+		g.printf("%s = new(%s)\n", target, elem.expr)
+		g.printf("}\n")
+		g.printf("count := fs.Counted()\n")
+		if elem.kind == kindStruct {
+			// don't validate the struct unless we keep it
+			if tags.required || elem.named {
+				g.printf("failures := fs.Failures()\n")
+			}
+			g.fields(elem, selector(elemTarget, target), key)
+			if tags.required || elem.named {
+				g.printf("if fs.Failures() == failures {\n")
+				switch {
+				case tags.required && elem.named:
+					g.printf("if fs.Counted() == count {\n")
+					g.missing(key)
+					g.printf("} else {\n")
+					g.validate(key, target)
+					g.printf("}\n")
+				case tags.required:
+					g.printf("if fs.Counted() == count {\n")
+					g.missing(key)
+					g.printf("}\n")
+				default:
+					g.printf("if fs.Counted() != count {\n")
+					g.validate(key, target)
+					g.printf("}\n")
+				}
+				g.printf("}\n")
+			}
+		} else {
+			g.read(elem, tags, elemTarget, target, key)
+		}
+		g.printf("if fs.Counted() == count {\n")
+		g.printf("%s = nil\n", target)
+		g.printf("}\n")
+	}
+	g.printf("}\n")
+}
+
+// Emit code that gets the value of a field of type t; it opens a block that
+// runs only if there is a value.
+func (g *generator) get(t *typeInfo, tags tags, key []string) {
+	empty := (t.kind == kindString || t.kind == kindSlice) && !tags.ignoreEmpty
+	g.printf("name := %s\n", keyLiteral(key))
+	g.printf("if got, ok := fs.Get(name, %t, %t, %t, %q); ok {\n", tags.required, tags.hasDefault, empty, tags.def)
+}
+
+// Emit code that converts the string expression src to a scalar type t, in
+// the format that the field's tags call for, and assigns it to target. The
+// code calls fail with an expression for the error if the string is
+// malformed, or then if all went well.
+func (g *generator) parse(t *typeInfo, tags tags, target, src string, fail func(err string), then func()) {
+	var call string
+	value := convert(t, "v")
+	switch {
+	case t.kind == kindString:
+		g.printf("%s = %s\n", target, convert(t, src))
+		then()
+		return
+	case tags.bytes && t.kind == kindInt:
+		// leave room for the sign, like implementation.decodeBytes
+		call = fmt.Sprintf("fs.ParseBytes(%s, %s-1)", src, bits(t))
+		value = t.expr + "(v)"
+	case tags.bytes && t.kind == kindUint:
+		call = fmt.Sprintf("fs.ParseBytes(%s, %s)", src, bits(t))
+	case tags.bytes:
+		call = fmt.Sprintf("fs.ParseBytes(%s, 64)", src)
+		value = t.expr + "(v)"
+	case tags.percent:
+		call = fmt.Sprintf("fs.ParsePercent(%s, %s)", src, bits(t))
+	case t.kind == kindBool:
+		call = fmt.Sprintf("strconv.ParseBool(%s)", src)
+	case t.kind == kindInt:
+		call = fmt.Sprintf("fs.ParseInt(%s, %s)", src, bits(t))
+	case t.kind == kindUint:
+		call = fmt.Sprintf("fs.ParseUint(%s, %s)", src, bits(t))
+	case t.kind == kindFloat:
+		call = fmt.Sprintf("strconv.ParseFloat(%s, %s)", src, bits(t))
+	}
+	g.strconv = g.strconv || strings.Contains(call, "strconv.")
+	g.printf("if v, err := %s; err != nil {\n", call)
+	fail("&flatpack.BadValue{Name: name, Cause: err}")
+	g.printf("} else {\n")
+	g.printf("%s = %s\n", target, value)
+	then()
+	g.printf("}\n")
+}
+
+// Return code that checks a value against the field's rules and then
+// validates it, like implementation.check and implementation.validate.
+func (g *generator) checks(t *typeInfo, tags tags, target, addr string) string {
+	var failed []string
+	var rules []string
+	for _, option := range tags.rules {
+		rule := option.Name
+		if option.Value != "" {
+			rule += "=" + option.Value
+		}
+		length := t.kind == kindString || t.kind == kindSlice
+		var cond string
+		switch option.Name {
+		case "min", "max":
+			limit, _ := strconv.ParseFloat(option.Value, 64)
+			op := ">="
+			if option.Name == "max" {
+				op = "<="
+			}
+			switch {
+			case length:
+				cond = fmt.Sprintf("!(float64(len(%s)) %s %s)", target, op, literal(limit))
+			case t.kind != kindBool:
+				cond = fmt.Sprintf("!(float64(%s) %s %s)", target, op, literal(limit))
+			}
+		case "nonempty":
+			if length {
+				cond = fmt.Sprintf("len(%s) == 0", target)
+			}
+		default:
+			if t.kind == kindSlice {
+				elem, value := t.elem, "e"
+				if elem.kind == kindPtr {
+					elem, value = elem.elem, "*e"
+				}
+				cond = fmt.Sprintf("!func() bool {\nfor _, e := range %s {\nif !fs.Match(%q, %s) {\nreturn false\n}\n}\nreturn true\n}()",
+					target, rule, g.format(elem, value))
+			} else {
+				cond = fmt.Sprintf("!fs.Match(%q, %s)", rule, g.format(t, target))
+			}
+		}
+		if cond != "" {
+			failed = append(failed, cond)
+			rules = append(rules, rule)
+		}
+	}
+
+	code := strings.Builder{}
+	for i, cond := range failed {
+		if i > 0 {
+			code.WriteString(" else ")
+		}
+		fmt.Fprintf(&code, "if %s {\n", cond)
+		fmt.Fprintf(&code, "fs.Fail(&flatpack.InvalidValue{Name: name, Rule: %q}, got, %t)\n", rules[i], tags.secret)
+		code.WriteString("}")
+	}
+	if t.named {
+		if len(failed) > 0 {
+			code.WriteString(" else {\n")
+		}
+		fmt.Fprintf(&code, "fs.Fail(fs.Validate(name, %s), got, %t)\n", addr, tags.secret)
+		if len(failed) > 0 {
+			code.WriteString("}")
+		}
+	}
+	if code.Len() > 0 {
+		code.WriteString("\n")
+	}
+	return code.String()
+}
+
+// Emit code that records a MissingValue.
+func (g *generator) missing(key []string) {
+	g.printf("fs.Fail(&flatpack.MissingValue{Name: %s}, \"\", false)\n", keyLiteral(key))
+}
+
+// Emit code that validates a struct.
+func (g *generator) validate(key []string, addr string) {
+	g.printf("fs.Fail(fs.Validate(%s, %s), \"\", false)\n", keyLiteral(key), addr)
+}
+
+// Return an expression that formats a scalar value like flatpack.format.
+func (g *generator) format(t *typeInfo, value string) string {
+	switch t.kind {
+	case kindBool:
+		g.strconv = true
+		return fmt.Sprintf("strconv.FormatBool(%s)", unconvert(t, value))
+	case kindInt:
+		g.strconv = true
+		return fmt.Sprintf("strconv.FormatInt(int64(%s), 10)", value)
+	case kindUint:
+		g.strconv = true
+		return fmt.Sprintf("strconv.FormatUint(uint64(%s), 10)", value)
+	case kindFloat:
+		g.strconv = true
+		return fmt.Sprintf("strconv.FormatFloat(float64(%s), 'g', -1, %d)", value, t.bits)
+	}
+	return unconvert(t, value)
+}
+
+// Convert value from the type that strconv parses to the type t.
+func convert(t *typeInfo, value string) string {
+	if t.expr == parsed[t.kind] {
+		return value
+	}
+	return t.expr + "(" + value + ")"
+}
+
+// Convert value from type t to the type that strconv parses.
+func unconvert(t *typeInfo, value string) string {
+	if t.expr == parsed[t.kind] {
+		return value
+	}
+	return parsed[t.kind] + "(" + value + ")"
+}
+
+// Return the size argument for strconv.Parse*.
+func bits(t *typeInfo) string {
+	if t.bits == 0 {
+		return "strconv.IntSize"
+	}
+	return strconv.Itoa(t.bits)
+}
+
+// Format a limit as a Go floating-point constant.
+func literal(limit float64) string {
+	return strconv.FormatFloat(limit, 'g', -1, 64)
+}
+
+// Return a Go expression for a Key.
+func keyLiteral(key []string) string {
+	quoted := make([]string, len(key))
+	for i, name := range key {
+		quoted[i] = strconv.Quote(name)
+	}
+	return "flatpack.Key{" + strings.Join(quoted, ", ") + "}"
+}
+
+// Return an expression that selects fields of the struct denoted by target;
+// addr is its address.
+func selector(target, addr string) string {
+	switch {
+	case !strings.HasPrefix(target, "*"):
+		return target
+	case !strings.HasPrefix(addr, "*") && !strings.HasPrefix(addr, "&"):
+		return addr
+	}
+	return "(" + target + ")"
+}
+
+// Parenthesize target if it is a dereference.
+func paren(target string) string {
+	if strings.HasPrefix(target, "*") {
+		return "(" + target + ")"
+	}
+	return target
+}
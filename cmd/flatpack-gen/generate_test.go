@@ -0,0 +1,131 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("generate", func() {
+	// Generate code for type Config, declared in src.
+	gen := func(src string) (string, error) {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, "config.go", "package config\n"+src, 0)
+		Expect(err).NotTo(HaveOccurred())
+		out, err := generate(fset, []*ast.File{file}, []string{"Config"})
+		return string(out), err
+	}
+
+	It("is up to date with the example", func() {
+		dir := filepath.Join("internal", "example")
+		output := filepath.Join(dir, "config_flatpack.go")
+		fset := token.NewFileSet()
+		files, err := parseDir(fset, dir, output)
+		Expect(err).NotTo(HaveOccurred())
+		src, err := generate(fset, files, []string{"Config"})
+		Expect(err).NotTo(HaveOccurred())
+		existing, err := os.ReadFile(output)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(src)).To(Equal(string(existing)), "run go generate in %s", dir)
+	})
+
+	It("imports only what it needs", func() {
+		src, err := gen("type Config struct { Name string }")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(src).NotTo(ContainSubstring(`"strconv"`))
+		Expect(src).To(ContainSubstring("func (c *Config) UnmarshalFlatpack(source flatpack.Getter) error {"))
+
+		src, err = gen("type Config struct { Count int8; Size uint64 `flatpack:\"bytes\"` }")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(src).NotTo(ContainSubstring(`"strconv"`))
+	})
+
+	It("reads values with units", func() {
+		src, err := gen("type Config struct { Mem int `flatpack:\"bytes\"`; Share float32 `flatpack:\"percent\"` }")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(src).To(ContainSubstring("fs.ParseBytes(got, strconv.IntSize-1)"))
+		Expect(src).To(ContainSubstring("c.Mem = int(v)"))
+		Expect(src).To(ContainSubstring("fs.ParsePercent(got, 32)"))
+	})
+
+	It("recognizes Secret however flatpack is imported", func() {
+		src, err := gen(`import fp "github.com/xeger/flatpack"
+			type Config struct { Password fp.Secret }`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(src).To(ContainSubstring("c.Password = flatpack.Secret(got)"))
+	})
+
+	It("reads types from other packages like their underlying types", func() {
+		src, err := gen(`import (
+				"io"
+				clock "time"
+			)
+			type Config struct {
+				Timeout clock.Duration ` + "`flatpack:\"min=0\"`" + `
+				Delays  []clock.Duration
+				Output  io.Writer
+			}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(src).To(ContainSubstring(`clock "time"`))
+		Expect(src).NotTo(ContainSubstring(`"io"`))
+		Expect(src).To(ContainSubstring("c.Timeout = clock.Duration(v)"))
+		Expect(src).To(ContainSubstring("fs.Validate(name, &c.Timeout)"))
+		Expect(src).To(ContainSubstring("c.Delays = make([]clock.Duration, len(elems))"))
+		Expect(src).NotTo(ContainSubstring("Output"))
+	})
+
+	It("skips ignored fields", func() {
+		src, err := gen("type Config struct { Ch chan int `flatpack:\"ignore\"`; private int `flatpack:\"ignore\"` }")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(src).NotTo(ContainSubstring("Ch"))
+	})
+
+	It("skips interfaces, channels and functions", func() {
+		src, err := gen(`type Config struct {
+			Ch     chan int
+			OnLoad func() error
+			Logger interface{ Print(...any) }
+			Hook   Hook
+			err    error
+			Port   int
+		}
+		type Hook func(*Config)`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(src).To(ContainSubstring("c.Port"))
+		Expect(src).NotTo(MatchRegexp(`c\.(Ch|OnLoad|Logger|Hook|err)\b`))
+	})
+
+	failures := map[string]string{
+		"type Config struct { Labels map[string]string }":                       "config.go:2:22: field Labels: unsupported type map[string]string",
+		"type Config struct { Nested struct { C complex64 } }":                  "config.go:2:38: field C: unsupported type complex64",
+		"type Config struct { Timeout time.Duration }":                          "config.go:2:22: field Timeout: unsupported type time.Duration; package time isn't imported",
+		"import \"container/list\"; type Config struct { Jobs list.List }":      "config.go:2:47: field Jobs: unsupported type list.List",
+		"import \"time\"; type Config struct { Start time.Time }":               "config.go:2:37: field Start: unsupported type time.Time",
+		"type Config struct { Matrix [][]int }":                                 "config.go:2:22: field Matrix: unsupported type [][]int",
+		"type Config struct { name string }":                                    `config.go:2:22: field name: unexported field; mark it with flatpack:"ignore"`,
+		"type Config struct { Port int `flatpack:\"min=low\"` }":                "config.go:2:22: field Port: malformed field tag; min=low: ",
+		"type Config struct { *inner }; type inner struct{}":                    `config.go:2:22: field inner: unexported embedded pointer; mark it with flatpack:"ignore"`,
+		"type Config struct { Port flatpack.Optional[int] }":                    "config.go:2:22: field Port: unsupported type flatpack.Optional[int]",
+		"type Config struct { Size string `flatpack:\"bytes\"` }":               "config.go:2:22: field Size: bytes needs a numeric field",
+		"type Config struct { Share []int `flatpack:\"percent\"` }":             "config.go:2:22: field Share: percent needs a floating-point field",
+		"type Config struct { Flags any `flatpack:\"json\"` }":                  "config.go:2:22: field Flags: the json tag isn't supported yet",
+		"type Config struct { Host string `flatpack:\"alias=HOST\"` }":          "config.go:2:22: field Host: the alias tag isn't supported yet",
+		"type Config struct { Host string `flatpack:\"deprecated=use ADDR\"` }": "config.go:2:22: field Host: the deprecated tag isn't supported yet",
+		"type Config struct { Next *Config }":                                   "config.go:2:22: field Next: recursive type Config",
+		"type Config string":                                                    "type Config is not a struct",
+		"type Other struct {}":                                                  "type Config not found",
+	}
+	for src, message := range failures {
+		src, message := src, message
+		It("rejects "+src, func() {
+			_, err := gen(src)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix(message))
+		})
+	}
+})
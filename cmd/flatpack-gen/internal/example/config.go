@@ -0,0 +1,92 @@
+// Package example exercises code generated by flatpack-gen, by comparing it
+// against the reflective implementation of flatpack.Unmarshal.
+package example
+
+import (
+	"errors"
+	"time"
+
+	"github.com/xeger/flatpack"
+)
+
+//go:generate go run github.com/xeger/flatpack/cmd/flatpack-gen -type Config
+
+type Level string
+
+func (l Level) Validate() error {
+	if l == "warn" {
+		return errors.New("warn is deprecated")
+	}
+	return nil
+}
+
+type Database struct {
+	Host     string `flatpack:"required,hostname"`
+	Port     uint16 `flatpack:"default=5432,min=1"`
+	Password flatpack.Secret
+}
+
+func (d *Database) Validate() error {
+	if d.Host == "localhost" && d.Port != 5432 {
+		return errors.New("local databases use the default port")
+	}
+	return nil
+}
+
+// Settings shared by several apps; its fields are promoted into Config.
+type Common struct {
+	LogLevel string `flatpack:"default=info"`
+	// Name is hidden by Config.Name
+	Name string
+}
+
+type Tracing struct {
+	Endpoint string `flatpack:"hostname"`
+	Sample   float64
+}
+
+type labels struct {
+	Team string
+}
+
+type Legacy struct {
+	Mode string
+}
+
+type Config struct {
+	Common
+	*Tracing
+	labels
+	Legacy   `flatpack:"prefix"`
+	Name     string `flatpack:"nonempty,desc=Name of the app"`
+	Debug    bool
+	Level    Level   `flatpack:"default=info,oneof=debug|info|warn"`
+	Ratio    float32 `flatpack:"min=0,max=1"`
+	Count    int8
+	Hosts    []string `flatpack:"min=1,hostname"`
+	Ports    []*int   `flatpack:"max=3"`
+	Database Database
+	Replica  *Database
+	Timeout  *float64
+	Token    string        `flatpack:"secret,pattern=^[a-z]+$"`
+	Memory   int64         `flatpack:"bytes,default=512MiB,max=1073741824"`
+	Buffers  []*uint32     `flatpack:"bytes"`
+	Share    float32       `flatpack:"percent,max=1"`
+	Interval time.Duration `flatpack:"min=0"`
+	Extra    struct {
+		Levels []Level
+		Limit  **uint
+	}
+	Cache *struct {
+		Size int `flatpack:"required"`
+	}
+	Internal chan int `flatpack:"ignore"`
+	skipped  int      `flatpack:"ignore"`
+}
+
+func (c *Config) Validate() error {
+	if c.Count < 0 {
+		return errors.New("count must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,433 @@
+// Code generated by flatpack-gen; DO NOT EDIT.
+
+package example
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/xeger/flatpack"
+)
+
+// UnmarshalFlatpack implements flatpack.GeneratedUnmarshaller.
+func (c *Config) UnmarshalFlatpack(source flatpack.Getter) error {
+	fs := flatpack.NewFields(source)
+	{
+		name := flatpack.Key{"LogLevel"}
+		if got, ok := fs.Get(name, false, true, true, "info"); ok {
+			fs.Count(1)
+			c.Common.LogLevel = got
+		}
+	}
+	{
+		if c.Tracing == nil {
+			c.Tracing = new(Tracing)
+		}
+		count := fs.Counted()
+		{
+			name := flatpack.Key{"Endpoint"}
+			if got, ok := fs.Get(name, false, false, true, ""); ok {
+				fs.Count(1)
+				c.Tracing.Endpoint = got
+				if !fs.Match("hostname", c.Tracing.Endpoint) {
+					fs.Fail(&flatpack.InvalidValue{Name: name, Rule: "hostname"}, got, false)
+				}
+			}
+		}
+		{
+			name := flatpack.Key{"Sample"}
+			if got, ok := fs.Get(name, false, false, false, ""); ok {
+				fs.Count(1)
+				if v, err := strconv.ParseFloat(got, 64); err != nil {
+					fs.Fail(&flatpack.BadValue{Name: name, Cause: err}, got, false)
+				} else {
+					c.Tracing.Sample = v
+				}
+			}
+		}
+		if fs.Counted() == count {
+			c.Tracing = nil
+		}
+	}
+	{
+		name := flatpack.Key{"Team"}
+		if got, ok := fs.Get(name, false, false, true, ""); ok {
+			fs.Count(1)
+			c.labels.Team = got
+		}
+	}
+	{
+		failures := fs.Failures()
+		{
+			name := flatpack.Key{"Legacy", "Mode"}
+			if got, ok := fs.Get(name, false, false, true, ""); ok {
+				fs.Count(1)
+				c.Legacy.Mode = got
+			}
+		}
+		if fs.Failures() == failures {
+			fs.Fail(fs.Validate(flatpack.Key{"Legacy"}, &c.Legacy), "", false)
+		}
+	}
+	{
+		name := flatpack.Key{"Name"}
+		if got, ok := fs.Get(name, false, false, true, ""); ok {
+			fs.Count(1)
+			c.Name = got
+			if len(c.Name) == 0 {
+				fs.Fail(&flatpack.InvalidValue{Name: name, Rule: "nonempty"}, got, false)
+			}
+		}
+	}
+	{
+		name := flatpack.Key{"Debug"}
+		if got, ok := fs.Get(name, false, false, false, ""); ok {
+			fs.Count(1)
+			if v, err := strconv.ParseBool(got); err != nil {
+				fs.Fail(&flatpack.BadValue{Name: name, Cause: err}, got, false)
+			} else {
+				c.Debug = v
+			}
+		}
+	}
+	{
+		name := flatpack.Key{"Level"}
+		if got, ok := fs.Get(name, false, true, true, "info"); ok {
+			fs.Count(1)
+			c.Level = Level(got)
+			if !fs.Match("oneof=debug|info|warn", string(c.Level)) {
+				fs.Fail(&flatpack.InvalidValue{Name: name, Rule: "oneof=debug|info|warn"}, got, false)
+			} else {
+				fs.Fail(fs.Validate(name, &c.Level), got, false)
+			}
+		}
+	}
+	{
+		name := flatpack.Key{"Ratio"}
+		if got, ok := fs.Get(name, false, false, false, ""); ok {
+			fs.Count(1)
+			if v, err := strconv.ParseFloat(got, 32); err != nil {
+				fs.Fail(&flatpack.BadValue{Name: name, Cause: err}, got, false)
+			} else {
+				c.Ratio = float32(v)
+				if !(float64(c.Ratio) >= 0) {
+					fs.Fail(&flatpack.InvalidValue{Name: name, Rule: "min=0"}, got, false)
+				} else if !(float64(c.Ratio) <= 1) {
+					fs.Fail(&flatpack.InvalidValue{Name: name, Rule: "max=1"}, got, false)
+				}
+			}
+		}
+	}
+	{
+		name := flatpack.Key{"Count"}
+		if got, ok := fs.Get(name, false, false, false, ""); ok {
+			fs.Count(1)
+			if v, err := fs.ParseInt(got, 8); err != nil {
+				fs.Fail(&flatpack.BadValue{Name: name, Cause: err}, got, false)
+			} else {
+				c.Count = int8(v)
+			}
+		}
+	}
+	{
+		name := flatpack.Key{"Hosts"}
+		if got, ok := fs.Get(name, false, false, true, ""); ok {
+			fs.Count(1)
+			if elems, err := fs.Elements(got); err != nil {
+				fs.Fail(err, got, false)
+			} else {
+				c.Hosts = make([]string, len(elems))
+				for i, elem := range elems {
+					c.Hosts[i] = elem
+				}
+				if !(float64(len(c.Hosts)) >= 1) {
+					fs.Fail(&flatpack.InvalidValue{Name: name, Rule: "min=1"}, got, false)
+				} else if !func() bool {
+					for _, e := range c.Hosts {
+						if !fs.Match("hostname", e) {
+							return false
+						}
+					}
+					return true
+				}() {
+					fs.Fail(&flatpack.InvalidValue{Name: name, Rule: "hostname"}, got, false)
+				}
+			}
+		}
+	}
+	{
+		name := flatpack.Key{"Ports"}
+		if got, ok := fs.Get(name, false, false, true, ""); ok {
+			fs.Count(1)
+			if elems, err := fs.Elements(got); err != nil {
+				fs.Fail(err, got, false)
+			} else {
+				c.Ports = make([]*int, len(elems))
+				failed := false
+				for i, elem := range elems {
+					c.Ports[i] = new(int)
+					if v, err := fs.ParseInt(elem, strconv.IntSize); err != nil {
+						fs.Fail(&flatpack.BadValue{Name: name, Cause: err}, got, false)
+						failed = true
+						break
+					} else {
+						*c.Ports[i] = int(v)
+					}
+				}
+				if !failed {
+					if !(float64(len(c.Ports)) <= 3) {
+						fs.Fail(&flatpack.InvalidValue{Name: name, Rule: "max=3"}, got, false)
+					}
+				}
+			}
+		}
+	}
+	{
+		failures := fs.Failures()
+		{
+			name := flatpack.Key{"Database", "Host"}
+			if got, ok := fs.Get(name, true, false, true, ""); ok {
+				fs.Count(1)
+				c.Database.Host = got
+				if !fs.Match("hostname", c.Database.Host) {
+					fs.Fail(&flatpack.InvalidValue{Name: name, Rule: "hostname"}, got, false)
+				}
+			}
+		}
+		{
+			name := flatpack.Key{"Database", "Port"}
+			if got, ok := fs.Get(name, false, true, false, "5432"); ok {
+				fs.Count(1)
+				if v, err := fs.ParseUint(got, 16); err != nil {
+					fs.Fail(&flatpack.BadValue{Name: name, Cause: err}, got, false)
+				} else {
+					c.Database.Port = uint16(v)
+					if !(float64(c.Database.Port) >= 1) {
+						fs.Fail(&flatpack.InvalidValue{Name: name, Rule: "min=1"}, got, false)
+					}
+				}
+			}
+		}
+		{
+			name := flatpack.Key{"Database", "Password"}
+			if got, ok := fs.Get(name, false, false, true, ""); ok {
+				fs.Count(1)
+				c.Database.Password = flatpack.Secret(got)
+			}
+		}
+		if fs.Failures() == failures {
+			fs.Fail(fs.Validate(flatpack.Key{"Database"}, &c.Database), "", false)
+		}
+	}
+	{
+		if c.Replica == nil {
+			c.Replica = new(Database)
+		}
+		count := fs.Counted()
+		failures := fs.Failures()
+		{
+			name := flatpack.Key{"Replica", "Host"}
+			if got, ok := fs.Get(name, true, false, true, ""); ok {
+				fs.Count(1)
+				c.Replica.Host = got
+				if !fs.Match("hostname", c.Replica.Host) {
+					fs.Fail(&flatpack.InvalidValue{Name: name, Rule: "hostname"}, got, false)
+				}
+			}
+		}
+		{
+			name := flatpack.Key{"Replica", "Port"}
+			if got, ok := fs.Get(name, false, true, false, "5432"); ok {
+				fs.Count(1)
+				if v, err := fs.ParseUint(got, 16); err != nil {
+					fs.Fail(&flatpack.BadValue{Name: name, Cause: err}, got, false)
+				} else {
+					c.Replica.Port = uint16(v)
+					if !(float64(c.Replica.Port) >= 1) {
+						fs.Fail(&flatpack.InvalidValue{Name: name, Rule: "min=1"}, got, false)
+					}
+				}
+			}
+		}
+		{
+			name := flatpack.Key{"Replica", "Password"}
+			if got, ok := fs.Get(name, false, false, true, ""); ok {
+				fs.Count(1)
+				c.Replica.Password = flatpack.Secret(got)
+			}
+		}
+		if fs.Failures() == failures {
+			if fs.Counted() != count {
+				fs.Fail(fs.Validate(flatpack.Key{"Replica"}, c.Replica), "", false)
+			}
+		}
+		if fs.Counted() == count {
+			c.Replica = nil
+		}
+	}
+	{
+		if c.Timeout == nil {
+			c.Timeout = new(float64)
+		}
+		count := fs.Counted()
+		{
+			name := flatpack.Key{"Timeout"}
+			if got, ok := fs.Get(name, false, false, false, ""); ok {
+				fs.Count(1)
+				if v, err := strconv.ParseFloat(got, 64); err != nil {
+					fs.Fail(&flatpack.BadValue{Name: name, Cause: err}, got, false)
+				} else {
+					*c.Timeout = v
+				}
+			}
+		}
+		if fs.Counted() == count {
+			c.Timeout = nil
+		}
+	}
+	{
+		name := flatpack.Key{"Token"}
+		if got, ok := fs.Get(name, false, false, true, ""); ok {
+			fs.Count(1)
+			c.Token = got
+			if !fs.Match("pattern=^[a-z]+$", c.Token) {
+				fs.Fail(&flatpack.InvalidValue{Name: name, Rule: "pattern=^[a-z]+$"}, got, true)
+			}
+		}
+	}
+	{
+		name := flatpack.Key{"Memory"}
+		if got, ok := fs.Get(name, false, true, false, "512MiB"); ok {
+			fs.Count(1)
+			if v, err := fs.ParseBytes(got, 64-1); err != nil {
+				fs.Fail(&flatpack.BadValue{Name: name, Cause: err}, got, false)
+			} else {
+				c.Memory = int64(v)
+				if !(float64(c.Memory) <= 1.073741824e+09) {
+					fs.Fail(&flatpack.InvalidValue{Name: name, Rule: "max=1073741824"}, got, false)
+				}
+			}
+		}
+	}
+	{
+		name := flatpack.Key{"Buffers"}
+		if got, ok := fs.Get(name, false, false, true, ""); ok {
+			fs.Count(1)
+			if elems, err := fs.Elements(got); err != nil {
+				fs.Fail(err, got, false)
+			} else {
+				c.Buffers = make([]*uint32, len(elems))
+				for i, elem := range elems {
+					c.Buffers[i] = new(uint32)
+					if v, err := fs.ParseBytes(elem, 32); err != nil {
+						fs.Fail(&flatpack.BadValue{Name: name, Cause: err}, got, false)
+						break
+					} else {
+						*c.Buffers[i] = uint32(v)
+					}
+				}
+			}
+		}
+	}
+	{
+		name := flatpack.Key{"Share"}
+		if got, ok := fs.Get(name, false, false, false, ""); ok {
+			fs.Count(1)
+			if v, err := fs.ParsePercent(got, 32); err != nil {
+				fs.Fail(&flatpack.BadValue{Name: name, Cause: err}, got, false)
+			} else {
+				c.Share = float32(v)
+				if !(float64(c.Share) <= 1) {
+					fs.Fail(&flatpack.InvalidValue{Name: name, Rule: "max=1"}, got, false)
+				}
+			}
+		}
+	}
+	{
+		name := flatpack.Key{"Interval"}
+		if got, ok := fs.Get(name, false, false, false, ""); ok {
+			fs.Count(1)
+			if v, err := fs.ParseInt(got, 64); err != nil {
+				fs.Fail(&flatpack.BadValue{Name: name, Cause: err}, got, false)
+			} else {
+				c.Interval = time.Duration(v)
+				if !(float64(c.Interval) >= 0) {
+					fs.Fail(&flatpack.InvalidValue{Name: name, Rule: "min=0"}, got, false)
+				} else {
+					fs.Fail(fs.Validate(name, &c.Interval), got, false)
+				}
+			}
+		}
+	}
+	{
+		{
+			name := flatpack.Key{"Extra", "Levels"}
+			if got, ok := fs.Get(name, false, false, true, ""); ok {
+				fs.Count(1)
+				if elems, err := fs.Elements(got); err != nil {
+					fs.Fail(err, got, false)
+				} else {
+					c.Extra.Levels = make([]Level, len(elems))
+					for i, elem := range elems {
+						c.Extra.Levels[i] = Level(elem)
+					}
+				}
+			}
+		}
+		{
+			if c.Extra.Limit == nil {
+				c.Extra.Limit = new(*uint)
+			}
+			count := fs.Counted()
+			{
+				if *c.Extra.Limit == nil {
+					*c.Extra.Limit = new(uint)
+				}
+				count := fs.Counted()
+				{
+					name := flatpack.Key{"Extra", "Limit"}
+					if got, ok := fs.Get(name, false, false, false, ""); ok {
+						fs.Count(1)
+						if v, err := fs.ParseUint(got, strconv.IntSize); err != nil {
+							fs.Fail(&flatpack.BadValue{Name: name, Cause: err}, got, false)
+						} else {
+							**c.Extra.Limit = uint(v)
+						}
+					}
+				}
+				if fs.Counted() == count {
+					*c.Extra.Limit = nil
+				}
+			}
+			if fs.Counted() == count {
+				c.Extra.Limit = nil
+			}
+		}
+	}
+	{
+		if c.Cache == nil {
+			c.Cache = new(struct {
+				Size int `flatpack:"required"`
+			})
+		}
+		count := fs.Counted()
+		{
+			name := flatpack.Key{"Cache", "Size"}
+			if got, ok := fs.Get(name, true, false, false, ""); ok {
+				fs.Count(1)
+				if v, err := fs.ParseInt(got, strconv.IntSize); err != nil {
+					fs.Fail(&flatpack.BadValue{Name: name, Cause: err}, got, false)
+				} else {
+					c.Cache.Size = int(v)
+				}
+			}
+		}
+		if fs.Counted() == count {
+			c.Cache = nil
+		}
+	}
+	if fs.Failures() == 0 {
+		fs.Fail(fs.Validate(flatpack.Key{}, c), "", false)
+	}
+	return fs.Err()
+}
@@ -0,0 +1,129 @@
+package example
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/xeger/flatpack"
+)
+
+// A Getter that reads from a map of environment variables.
+type environment map[string]string
+
+func (e environment) Get(name flatpack.Key) (string, error) {
+	return e[name.AsEnv()], nil
+}
+
+func (e environment) Lookup(name flatpack.Key) (string, bool, error) {
+	value, ok := e[name.AsEnv()]
+	return value, ok, nil
+}
+
+var _ flatpack.GeneratedUnmarshaller = &Config{}
+
+var _ = Describe("generated code", func() {
+	valid := environment{
+		"NAME":          "app",
+		"DEBUG":         "true",
+		"LEVEL":         "debug",
+		"RATIO":         "0.5",
+		"COUNT":         "7",
+		"HOSTS":         `["a.example.com","b"]`,
+		"PORTS":         "[80,443]",
+		"DATABASE_HOST": "db",
+		"REPLICA_HOST":  "replica",
+		"REPLICA_PORT":  "6543",
+		"TIMEOUT":       "1.5",
+		"TOKEN":         "abc",
+		"MEMORY":        "256MiB",
+		"BUFFERS":       `["4KiB",1024]`,
+		"SHARE":         "12.5%",
+		"INTERVAL":      "1500000000",
+		"EXTRA_LEVELS":  `["info","warn"]`,
+		"EXTRA_LIMIT":   "10",
+		"CACHE_SIZE":    "64",
+		"LOG_LEVEL":     "warn",
+		"ENDPOINT":      "trace.example.com",
+		"TEAM":          "core",
+		"LEGACY_MODE":   "old",
+	}
+
+	// Return a copy of valid with some variables changed; empty values
+	// remove variables.
+	with := func(changes map[string]string) environment {
+		env := environment{}
+		for k, v := range valid {
+			env[k] = v
+		}
+		for k, v := range changes {
+			if v == "" {
+				delete(env, k)
+			} else {
+				env[k] = v
+			}
+		}
+		return env
+	}
+
+	// Return a copy of valid with some variables set but empty.
+	emptied := func(names ...string) environment {
+		env := with(nil)
+		for _, name := range names {
+			env[name] = ""
+		}
+		return env
+	}
+
+	cases := map[string]environment{
+		"set but empty":   emptied("NAME", "LEVEL", "HOSTS", "PORTS", "COUNT", "TOKEN", "LOG_LEVEL", "EXTRA_LEVELS", "EXTRA_LIMIT", "INTERVAL"),
+		"valid":           valid,
+		"empty":           {},
+		"defaults":        with(map[string]string{"LEVEL": "", "REPLICA_PORT": "", "REPLICA_HOST": "", "TIMEOUT": ""}),
+		"malformed":       with(map[string]string{"DEBUG": "maybe", "COUNT": "300", "RATIO": "x", "REPLICA_PORT": "-1", "MEMORY": "1.5B", "SHARE": "half", "INTERVAL": "1s"}),
+		"malformed lists": with(map[string]string{"HOSTS": "a", "PORTS": `[1,"x",3]`, "EXTRA_LIMIT": "-5", "BUFFERS": `["5GiB"]`}),
+		"invalid":         with(map[string]string{"NAME": "", "RATIO": "2", "HOSTS": "[]", "PORTS": "[1,2,3,4]", "LEVEL": "error", "MEMORY": "2GiB", "SHARE": "150%", "INTERVAL": "-1"}),
+		"invalid hosts":   with(map[string]string{"HOSTS": `["ok","not ok"]`, "DATABASE_HOST": "-"}),
+		"secret":          with(map[string]string{"TOKEN": "HUSH"}),
+		"validate field":  with(map[string]string{"LEVEL": "warn"}),
+		"validate struct": with(map[string]string{"DATABASE_HOST": "localhost", "DATABASE_PORT": "1", "REPLICA_HOST": "localhost"}),
+		"validate config": with(map[string]string{"COUNT": "-1"}),
+		"missing nested":  with(map[string]string{"CACHE_SIZE": "", "DATABASE_HOST": ""}),
+		"no tracing":      with(map[string]string{"ENDPOINT": "", "LOG_LEVEL": ""}),
+		"invalid tracing": with(map[string]string{"ENDPOINT": "-", "SAMPLE": "x"}),
+	}
+
+	for name, env := range cases {
+		env := env
+		It("behaves like reflection with "+name+" values", func() {
+			generated := Config{}
+			generatedErr := flatpack.New(env).Unmarshal(&generated)
+
+			// asking for a report makes flatpack fall back on reflection
+			reflected := Config{}
+			_, reflectedErr := flatpack.New(env).UnmarshalWithReport(&reflected)
+
+			Expect(generated).To(Equal(reflected))
+			if reflectedErr == nil {
+				Expect(generatedErr).NotTo(HaveOccurred())
+			} else {
+				Expect(generatedErr).To(MatchError(reflectedErr.Error()))
+			}
+		})
+	}
+
+	It("populates the config", func() {
+		config := Config{}
+		Expect(flatpack.New(valid).Unmarshal(&config)).To(Succeed())
+		Expect(config.Name).To(Equal("app"))
+		Expect(**config.Extra.Limit).To(Equal(uint(10)))
+		Expect(config.Cache.Size).To(Equal(64))
+		Expect(config.LogLevel).To(Equal("warn"))
+		Expect(config.Common.Name).To(BeEmpty())
+		Expect(config.Endpoint).To(Equal("trace.example.com"))
+		Expect(config.Team).To(Equal("core"))
+		Expect(config.Legacy.Mode).To(Equal("old"))
+		Expect(config.Memory).To(Equal(int64(256 << 20)))
+		Expect(*config.Buffers[0]).To(Equal(uint32(4096)))
+		Expect(config.Share).To(Equal(float32(0.125)))
+	})
+})
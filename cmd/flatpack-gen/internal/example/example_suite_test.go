@@ -0,0 +1,13 @@
+package example
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestExample(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Example Suite")
+}
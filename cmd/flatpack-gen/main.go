@@ -0,0 +1,93 @@
+// Command flatpack-gen generates UnmarshalFlatpack methods for config structs,
+// which let flatpack.Unmarshal populate them without using reflection. Add a
+// directive to the package that declares the struct:
+//
+//	//go:generate flatpack-gen -type Config
+//
+// and run go generate. The generated method derives keys, interprets field
+// tags and reports errors exactly like flatpack.Unmarshal does; fields whose
+// types flatpack can't handle are reported when the code is generated
+// rather than when it runs.
+//
+// Types from other packages, such as time.Duration, are read like their
+// underlying type if that is a number, string or bool. Some things that
+// flatpack.Unmarshal handles aren't supported by the generator yet: fields of
+// complex, nested slice or flatpack.Optional type, fields of any other type
+// from another package, e.g. a struct, and the json, alias and deprecated
+// tags. The generator fails with an error that names the field instead;
+// structs that need them must be read by reflection, i.e. without a generated
+// method.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	typeNames := flag.String("type", "", "comma-separated list of struct type names; required")
+	output := flag.String("output", "", "output file name; default <dir>/<type>_flatpack.go")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: flatpack-gen -type T [-output file] [dir]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *typeNames == "" || flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+	types := strings.Split(*typeNames, ",")
+	if *output == "" {
+		*output = filepath.Join(dir, strings.ToLower(types[0])+"_flatpack.go")
+	}
+
+	fset := token.NewFileSet()
+	files, err := parseDir(fset, dir, *output)
+	if err == nil {
+		var src []byte
+		src, err = generate(fset, files, types)
+		if err == nil {
+			err = os.WriteFile(*output, src, 0644)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "flatpack-gen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// Parse the non-test Go files of a directory, except for the output file.
+func parseDir(fset *token.FileSet, dir, output string) ([]*ast.File, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []*ast.File
+	for _, entry := range entries {
+		name := filepath.Join(dir, entry.Name())
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") ||
+			filepath.Clean(name) == filepath.Clean(output) {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no Go files in %s", dir)
+	}
+	return files, nil
+}
@@ -0,0 +1,47 @@
+package flatpack
+
+import "log/slog"
+
+// WithDeprecationHandler makes an Unmarshaller call handler whenever a field
+// is read from a variable that is deprecated: one that is named in the
+// field's flatpack:"alias=..." tag, or that of a field with the
+// flatpack:"deprecated" tag. The message says which variable it is and
+// usually what to use instead, e.g. "DB_HOST is deprecated; use
+// DATABASE_HOST instead". The field is populated all the same.
+func WithDeprecationHandler(handler func(name Key, message string)) Option {
+	return func(f *implementation) {
+		f.deprecated = handler
+	}
+}
+
+// WithDeprecationLogger is like WithDeprecationHandler, but logs a warning
+// to logger instead of calling a function.
+func WithDeprecationLogger(logger *slog.Logger) Option {
+	return WithDeprecationHandler(func(name Key, message string) {
+		logDeprecation(logger, name, message)
+	})
+}
+
+// WithStrictDeprecations makes an Unmarshaller fail with DeprecatedValue
+// whenever a field is read from a deprecated variable, rather than
+// populating the field and calling a deprecation handler. Turn it on in CI to
+// find the deployments that still use old names.
+func WithStrictDeprecations() Option {
+	return func(f *implementation) {
+		f.strict = true
+	}
+}
+
+// Warn about a field that was read from a deprecated variable, or complain
+// about it if deprecations are errors.
+func (f implementation) deprecate(name Key, message string) error {
+	if f.strict {
+		return &DeprecatedValue{Name: name, Message: message}
+	}
+	if f.deprecated != nil {
+		f.deprecated(name, message)
+	} else if f.logger != nil {
+		logDeprecation(f.logger, name, message)
+	}
+	return nil
+}
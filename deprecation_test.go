@@ -0,0 +1,131 @@
+package flatpack
+
+import (
+	"bytes"
+	"log/slog"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type obsolete struct {
+	Verbose bool   `flatpack:"deprecated=use LOG_LEVEL=debug instead"`
+	Mode    string `flatpack:"deprecated"`
+	Level   string `flatpack:"alias=LOG_LEVEL"`
+}
+
+type renamed struct {
+	Host   string   `flatpack:"alias=DB_HOST|DATABASE_HOSTNAME"`
+	Port   int      `flatpack:"required,alias=DB_PORT"`
+	Tokens []string `flatpack:"alias=TOKEN_LIST"`
+}
+
+var _ = Describe("aliases", func() {
+	var warnings []string
+	handler := func(name Key, message string) {
+		warnings = append(warnings, name.String()+": "+message)
+	}
+	BeforeEach(func() { warnings = nil })
+
+	It("are used if the field's own variable isn't set", func() {
+		fx := renamed{}
+		it := New(stubEnvironment(map[string]string{
+			"DB_HOST":           "old",
+			"DATABASE_HOSTNAME": "older",
+			"PORT":              "5432",
+			"DB_PORT":           "1",
+			"TOKEN_LIST":        "[]",
+		}), WithDeprecationHandler(handler))
+		Expect(it.Unmarshal(&fx)).To(Succeed())
+		Expect(fx).To(Equal(renamed{Host: "old", Port: 5432, Tokens: []string{}}))
+		Expect(warnings).To(Equal([]string{
+			"Host: DB_HOST is deprecated; use HOST instead",
+			"Tokens: TOKEN_LIST is deprecated; use TOKENS instead",
+		}))
+	})
+
+	It("are tried in order", func() {
+		fx := renamed{}
+		it := New(stubEnvironment(map[string]string{
+			"DB_HOST":           "",
+			"DATABASE_HOSTNAME": "older",
+			"DB_PORT":           "1",
+		}), WithDeprecationHandler(handler))
+		Expect(it.Unmarshal(&fx)).To(Succeed())
+		Expect(fx.Host).To(Equal(""))
+		Expect(warnings).To(ConsistOf(
+			"Host: DB_HOST is deprecated; use HOST instead",
+			"Port: DB_PORT is deprecated; use PORT instead",
+		))
+	})
+
+	It("satisfy required fields", func() {
+		err := New(stubEnvironment(map[string]string{"DB_PORT": ""})).Unmarshal(&renamed{})
+		Expect(err).To(MatchError(ContainSubstring("required but empty")))
+
+		vars, err := Variables(&renamed{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vars[0].Aliases).To(Equal([]string{"DB_HOST", "DATABASE_HOSTNAME"}))
+	})
+})
+
+var _ = Describe("deprecated fields", func() {
+	env := map[string]string{"VERBOSE": "true", "LOG_LEVEL": "debug"}
+
+	It("are populated with a warning", func() {
+		var warnings []string
+		fx := obsolete{}
+		it := New(stubEnvironment(env), WithDeprecationHandler(func(name Key, message string) {
+			warnings = append(warnings, name.String()+": "+message)
+		}))
+		Expect(it.Unmarshal(&fx)).To(Succeed())
+		Expect(fx).To(Equal(obsolete{Verbose: true, Level: "debug"}))
+		Expect(warnings).To(Equal([]string{
+			"Verbose: VERBOSE is deprecated; use LOG_LEVEL=debug instead",
+			"Level: LOG_LEVEL is deprecated; use LEVEL instead",
+		}))
+	})
+
+	It("may be logged", func() {
+		buf := bytes.Buffer{}
+		logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+				return a
+			},
+		}))
+		it := New(stubEnvironment(map[string]string{"MODE": "x"}), WithDeprecationLogger(logger))
+		Expect(it.Unmarshal(&obsolete{})).To(Succeed())
+		Expect(buf.String()).To(Equal("level=WARN msg=\"flatpack: MODE is deprecated\" key=Mode\n"))
+	})
+
+	It("are errors in strict mode", func() {
+		fx := obsolete{}
+		err := New(stubEnvironment(env), WithStrictDeprecations()).Unmarshal(&fx)
+		Expect(err).To(HaveOccurred())
+		Expect(err.(Errors)).To(ConsistOf(
+			&DeprecatedValue{Name: Key{"Verbose"}, Message: "VERBOSE is deprecated; use LOG_LEVEL=debug instead"},
+			&DeprecatedValue{Name: Key{"Level"}, Message: "LOG_LEVEL is deprecated; use LEVEL instead"},
+		))
+		Expect(err).To(MatchError(ContainSubstring("flatpack: deprecated value; VERBOSE is deprecated")))
+		Expect(New(stubEnvironment(map[string]string{"LEVEL": "info"}), WithStrictDeprecations()).Unmarshal(&fx)).To(Succeed())
+
+		err = New(stubEnvironment(map[string]string{"MODE": "x"}), WithStrictDeprecations()).Unmarshal(&fx)
+		Expect(err).To(MatchError(&DeprecatedValue{Name: Key{"Mode"}, Message: "MODE is deprecated"}))
+	})
+
+	It("are documented", func() {
+		schema, err := Schema(&obsolete{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(schema.Properties["VERBOSE"].Deprecated).To(BeTrue())
+		Expect(schema.Properties["MODE"].Deprecated).To(BeTrue())
+		Expect(schema.Properties["LEVEL"].Deprecated).To(BeFalse())
+
+		buf := bytes.Buffer{}
+		Expect(Document(&buf, &obsolete{}, Usage)).To(Succeed())
+		Expect(buf.String()).To(ContainSubstring("(deprecated)"))
+		Expect(buf.String()).To(ContainSubstring("(alias LOG_LEVEL)"))
+	})
+})
@@ -0,0 +1,218 @@
+package flatpack
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+)
+
+// Variable describes one environment variable that Unmarshal reads.
+type Variable struct {
+	// Name is the field's key; use Name.AsEnv() for the variable name.
+	Name Key
+	// Type is the Go type the value is parsed into.
+	Type reflect.Type
+	// Format is "bytes" or "percent" if the field's tag lets values have
+	// units, e.g. 512MiB or 50%, and empty otherwise.
+	Format string
+	// Default is the value the field has if the variable is not set, in
+	// the format that Unmarshal expects. It is empty if there is none or the
+	// field is required, and Mask if the field is secret.
+	Default string
+	// Required is true if the field has the flatpack:"required" tag.
+	Required bool
+	// Secret is true if the field's value must not be revealed.
+	Secret bool
+	// Description comes from the field's flatpack:"desc=..." tag.
+	Description string
+	// Rules are the constraints declared in the field's tag, e.g. "min=1".
+	Rules []string
+	// Aliases are the other variables that the value may come from, as
+	// declared by the field's flatpack:"alias=..." tag.
+	Aliases []string
+	// Deprecated is true if the field has the flatpack:"deprecated" tag.
+	Deprecated bool
+}
+
+// DocFormat is an output format for Document.
+type DocFormat int
+
+const (
+	// EnvExample produces a .env.example file with one commented
+	// assignment per variable. The assignments of secret fields that have a
+	// default are commented out, so that copying the file doesn't replace
+	// the default with Mask.
+	EnvExample DocFormat = iota
+	// Markdown produces a Markdown table.
+	Markdown
+	// Usage produces aligned plain text suitable for a --help message.
+	Usage
+)
+
+// Variables lists every environment variable that Unmarshal would read into
+// config, in the order that it reads them.
+//
+// The config may be a struct, a pointer to a struct, or a nil pointer to a
+// struct type. The current value of every field is reported as its default,
+// since Unmarshal leaves fields alone if their variable isn't set, unless the
+// field has a flatpack:"default=..." tag or the value is the zero value.
+// Required fields have no default, because their variable must be set.
+func Variables(config interface{}) ([]Variable, error) {
+	v := reflect.ValueOf(config)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v = reflect.Zero(v.Type().Elem())
+		} else {
+			v = v.Elem()
+		}
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, &BadType{Name: Key{}, Kind: v.Kind(), reason: "expected struct"}
+	}
+
+	var vars []Variable
+	err := walk(v, true, func(name Key, field *reflect.StructField, value reflect.Value) error {
+		tags := parseTags(field)
+		var def string
+		switch {
+		case tags.required:
+			// the default is never used
+		case tags.hasDefault:
+			def = tags.def
+		case !value.IsZero():
+			var err error
+			if def, err = marshalField(name, tags, value); err != nil {
+				return err
+			}
+		}
+		if tags.secret && def != "" {
+			def = Mask
+		}
+		var format string
+		switch {
+		case tags.bytes:
+			format = "bytes"
+		case tags.percent:
+			format = "percent"
+		}
+		var rules []string
+		for _, r := range tags.rules {
+			rules = append(rules, r.String())
+		}
+		vars = append(vars, Variable{
+			Name:        name,
+			Type:        value.Type(),
+			Format:      format,
+			Default:     def,
+			Required:    tags.required,
+			Secret:      tags.secret,
+			Description: tags.desc,
+			Rules:       rules,
+			Aliases:     tags.aliases,
+			Deprecated:  tags.deprecated,
+		})
+		return nil
+	})
+	return vars, err
+}
+
+// Document writes a description of every environment variable that
+// Unmarshal would read into config. See Variables for details.
+func Document(w io.Writer, config interface{}, format DocFormat) error {
+	vars, err := Variables(config)
+	if err != nil {
+		return err
+	}
+
+	buf := bytes.Buffer{}
+	switch format {
+	case EnvExample:
+		for _, v := range vars {
+			fmt.Fprintf(&buf, "# %s\n", v.summary())
+			if v.Secret && v.Default != "" {
+				fmt.Fprintf(&buf, "# %s=\n", v.Name.AsEnv())
+			} else {
+				fmt.Fprintf(&buf, "%s=%s\n", v.Name.AsEnv(), quoteDotenvIfSet(v.Default))
+			}
+		}
+	case Markdown:
+		buf.WriteString("| Variable | Type | Default | Required | Description |\n")
+		buf.WriteString("|----------|------|---------|----------|-------------|\n")
+		for _, v := range vars {
+			required := "no"
+			if v.Required {
+				required = "yes"
+			}
+			def := ""
+			if v.Default != "" {
+				def = "`" + escapeMarkdown(v.Default) + "`"
+			}
+			fmt.Fprintf(&buf, "| `%s` | `%s` | %s | %s | %s |\n",
+				v.Name.AsEnv(), v.Type, def, required, escapeMarkdown(v.Description))
+		}
+	case Usage:
+		buf.WriteString("Environment variables:\n")
+		tw := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+		for _, v := range vars {
+			fmt.Fprintf(tw, "  %s\t%s", v.Name.AsEnv(), v.Type)
+			if usage := v.usage(); usage != "" {
+				fmt.Fprintf(tw, "\t%s", usage)
+			}
+			fmt.Fprintln(tw)
+		}
+		tw.Flush()
+	default:
+		return fmt.Errorf("flatpack: unknown documentation format %d", format)
+	}
+
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// A one-line description of a variable for comments.
+func (v Variable) summary() string {
+	attrs := v.Type.String()
+	if v.Required {
+		attrs += ", required"
+	}
+	if v.Description == "" {
+		return "(" + attrs + ")"
+	}
+	return fmt.Sprintf("%s (%s)", v.Description, attrs)
+}
+
+// A description of a variable for usage text.
+func (v Variable) usage() string {
+	var parts []string
+	if v.Description != "" {
+		parts = append(parts, v.Description)
+	}
+	if v.Deprecated {
+		parts = append(parts, "(deprecated)")
+	}
+	if len(v.Aliases) > 0 {
+		parts = append(parts, fmt.Sprintf("(alias %s)", strings.Join(v.Aliases, ", ")))
+	}
+	if v.Required {
+		parts = append(parts, "(required)")
+	} else if v.Default != "" {
+		parts = append(parts, fmt.Sprintf("(default %q)", v.Default))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Leave a missing value empty in a .env file rather than quoting it, to make
+// it obvious that it needs to be filled in.
+func quoteDotenvIfSet(value string) string {
+	if value == "" {
+		return ""
+	}
+	return quoteDotenv(value)
+}
+
+func escapeMarkdown(text string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(text)
+}
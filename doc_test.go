@@ -0,0 +1,94 @@
+package flatpack
+
+import (
+	"bytes"
+	"reflect"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type documented struct {
+	Port     int    `flatpack:"required,desc=Port to listen on"`
+	LogLevel string `flatpack:"default=info,desc=One of debug, info | warn"`
+	Hosts    []string
+	Database *struct {
+		URL string
+	}
+	Conn chan int `flatpack:"ignore"`
+}
+
+var _ = Describe("Variables()", func() {
+	It("lists every variable that Unmarshal reads", func() {
+		vars, err := Variables((*documented)(nil))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vars).To(Equal([]Variable{
+			{Name: Key{"Port"}, Type: reflect.TypeOf(0), Required: true, Description: "Port to listen on"},
+			{Name: Key{"LogLevel"}, Type: reflect.TypeOf(""), Default: "info", Description: "One of debug, info | warn"},
+			{Name: Key{"Hosts"}, Type: reflect.TypeOf([]string{})},
+			{Name: Key{"Database", "URL"}, Type: reflect.TypeOf("")},
+		}))
+	})
+
+	It("reports current values as defaults", func() {
+		vars, err := Variables(documented{Hosts: []string{"a"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vars[2].Default).To(Equal(`["a"]`))
+	})
+
+	It("reports no default for required fields", func() {
+		vars, err := Variables(documented{Port: 80})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vars[0].Default).To(BeEmpty())
+	})
+
+	It("complains about unsupported types", func() {
+		_, err := Variables(&badType{})
+		Expect(err).To(HaveOccurred())
+		_, err = Variables(42)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Document()", func() {
+	doc := func(format DocFormat) string {
+		buf := bytes.Buffer{}
+		Expect(Document(&buf, documented{}, format)).To(Succeed())
+		return buf.String()
+	}
+
+	It("writes .env.example files", func() {
+		Expect(doc(EnvExample)).To(Equal(
+			"# Port to listen on (int, required)\n" +
+				"PORT=\n" +
+				"# One of debug, info | warn (string)\n" +
+				"LOG_LEVEL=info\n" +
+				"# ([]string)\n" +
+				"HOSTS=\n" +
+				"# (string)\n" +
+				"DATABASE_URL=\n"))
+	})
+
+	It("writes Markdown tables", func() {
+		Expect(doc(Markdown)).To(Equal(
+			"| Variable | Type | Default | Required | Description |\n" +
+				"|----------|------|---------|----------|-------------|\n" +
+				"| `PORT` | `int` |  | yes | Port to listen on |\n" +
+				"| `LOG_LEVEL` | `string` | `info` | no | One of debug, info \\| warn |\n" +
+				"| `HOSTS` | `[]string` |  | no |  |\n" +
+				"| `DATABASE_URL` | `string` |  | no |  |\n"))
+	})
+
+	It("writes usage text", func() {
+		Expect(doc(Usage)).To(Equal(
+			"Environment variables:\n" +
+				"  PORT          int     Port to listen on (required)\n" +
+				"  LOG_LEVEL     string  One of debug, info | warn (default \"info\")\n" +
+				"  HOSTS         []string\n" +
+				"  DATABASE_URL  string\n"))
+	})
+
+	It("rejects unknown formats", func() {
+		Expect(Document(&bytes.Buffer{}, documented{}, DocFormat(42))).NotTo(Succeed())
+	})
+})
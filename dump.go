@@ -0,0 +1,112 @@
+package flatpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"text/tabwriter"
+)
+
+// DumpFormat is an output format for Dump.
+type DumpFormat int
+
+const (
+	// Table produces aligned plain text with one row per variable.
+	Table DumpFormat = iota
+	// JSON produces a JSON object whose keys are variable names, in the
+	// order that Unmarshal reads them.
+	JSON
+	// Dotenv produces a .env file like MarshalDotenv, except that empty
+	// values are included.
+	Dotenv
+)
+
+// A field's key and current value, as written by Dump.
+type dumped struct {
+	name  Key
+	value string
+	// raw is value as it should be represented in JSON
+	raw interface{}
+}
+
+// Dump writes the current value of every field of config that Unmarshal
+// would populate, under its environment variable name, to w. It is meant for
+// logging the effective configuration at startup, so the values of secret
+// fields are replaced by Mask.
+//
+// Fields are visited in the same way as by Unmarshal, so ignored fields are
+// left out; so are the fields of nil pointers to structs and of unset
+// Optionals. Values are formatted as Marshal formats them. The config may be
+// a struct or a pointer to a struct.
+func Dump(w io.Writer, config interface{}, format DumpFormat) error {
+	v, err := structValue(config)
+	if err != nil {
+		return err
+	}
+
+	var vars []dumped
+	err = walk(v, false, func(name Key, field *reflect.StructField, value reflect.Value) error {
+		tags := parseTags(field)
+		formatted, err := marshalField(name, tags, value)
+		if err != nil {
+			return err
+		}
+		var raw interface{}
+		switch {
+		case tags.secret && formatted != "":
+			formatted, raw = Mask, Mask
+		case tags.json || value.Kind() == reflect.Slice:
+			if formatted != "" {
+				raw = json.RawMessage(formatted)
+			}
+		default:
+			if raw, err = formatJSON(value); err != nil {
+				return &BadType{Name: name, Kind: value.Kind(), reason: "unsupported data type"}
+			}
+		}
+		vars = append(vars, dumped{name, formatted, raw})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	buf := bytes.Buffer{}
+	switch format {
+	case Table:
+		tw := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tVALUE")
+		for _, d := range vars {
+			fmt.Fprintf(tw, "%s\t%s\n", d.name.AsEnv(), d.value)
+		}
+		tw.Flush()
+	case JSON:
+		buf.WriteString("{")
+		for i, d := range vars {
+			name, _ := json.Marshal(d.name.AsEnv())
+			value, err := json.Marshal(d.raw)
+			if err != nil {
+				return &BadValue{Name: d.name, Cause: err}
+			}
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			fmt.Fprintf(&buf, "\n  %s: %s", name, value)
+		}
+		if len(vars) > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString("}\n")
+	case Dotenv:
+		for _, d := range vars {
+			fmt.Fprintf(&buf, "%s=%s\n", d.name.AsEnv(), quoteDotenv(d.value))
+		}
+	default:
+		return fmt.Errorf("flatpack: unknown dump format %d", format)
+	}
+
+	_, err = buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,92 @@
+package flatpack
+
+import (
+	"bytes"
+	"math"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type dumpable struct {
+	Host     string
+	Port     uint16
+	Password Secret
+	Token    string `flatpack:"secret"`
+	Debug    Optional[bool]
+	Hosts    []string
+	Limits   map[string]int `flatpack:"json"`
+	Conn     *int           `flatpack:"ignore"`
+	Nested   *struct {
+		Ratio float64
+	}
+}
+
+var _ = Describe("Dump()", func() {
+	fx := dumpable{
+		Host:     "db.example.com",
+		Port:     5432,
+		Password: "hunter2",
+		Debug:    Some(true),
+		Hosts:    []string{"a", "b c"},
+		Limits:   map[string]int{"cpu": 2},
+	}
+	dump := func(config interface{}, format DumpFormat) string {
+		buf := bytes.Buffer{}
+		Expect(Dump(&buf, config, format)).To(Succeed())
+		return buf.String()
+	}
+
+	It("writes an aligned table", func() {
+		Expect(dump(&fx, Table)).To(Equal("" +
+			"NAME      VALUE\n" +
+			"HOST      db.example.com\n" +
+			"PORT      5432\n" +
+			"PASSWORD  " + Mask + "\n" +
+			"TOKEN     \n" +
+			"DEBUG     true\n" +
+			"HOSTS     [\"a\",\"b c\"]\n" +
+			"LIMITS    {\"cpu\":2}\n"))
+	})
+
+	It("writes JSON", func() {
+		Expect(dump(fx, JSON)).To(MatchJSON(`{
+			"HOST": "db.example.com",
+			"PORT": 5432,
+			"PASSWORD": "` + Mask + `",
+			"TOKEN": "",
+			"DEBUG": true,
+			"HOSTS": ["a", "b c"],
+			"LIMITS": {"cpu": 2}
+		}`))
+		Expect(dump(&struct{}{}, JSON)).To(Equal("{}\n"))
+	})
+
+	It("writes a .env file", func() {
+		withToken := fx
+		withToken.Token = "s3cr3t"
+		Expect(dump(&withToken, Dotenv)).To(Equal("" +
+			"HOST=db.example.com\n" +
+			"PORT=5432\n" +
+			`PASSWORD="****"` + "\n" +
+			`TOKEN="****"` + "\n" +
+			"DEBUG=true\n" +
+			`HOSTS="[\"a\",\"b c\"]"` + "\n" +
+			`LIMITS="{\"cpu\":2}"` + "\n"))
+	})
+
+	It("complains about bad input", func() {
+		Expect(Dump(&bytes.Buffer{}, 42, Table)).To(MatchError(ContainSubstring("expected struct")))
+		Expect(Dump(&bytes.Buffer{}, &fx, DumpFormat(42))).To(MatchError("flatpack: unknown dump format 42"))
+	})
+
+	It("writes NaN and infinities as JSON strings", func() {
+		type ratios struct {
+			Ratio   float64
+			Limit   float32
+			Weights []float64
+		}
+		fx := ratios{math.NaN(), float32(math.Inf(1)), []float64{math.Inf(-1), 1}}
+		Expect(dump(&fx, JSON)).To(MatchJSON(`{"RATIO": "NaN", "LIMIT": "+Inf", "WEIGHTS": ["-Inf", 1]}`))
+	})
+})
@@ -3,6 +3,7 @@ package flatpack
 import (
 	"fmt"
 	"reflect"
+	"strings"
 )
 
 // BadType is an error that provides information about invalid types
@@ -18,7 +19,8 @@ func (e *BadType) Error() string {
 }
 
 // BadValue is an error that provides information about malformed values
-// encountered while unmarshalling.
+// encountered while unmarshalling. If the field is secret, the value is
+// masked in the Cause.
 type BadValue struct {
 	Name     Key
 	Cause    error
@@ -32,6 +34,78 @@ func (e *BadValue) Error() string {
 	return fmt.Sprintf("flatpack: invalid value; expected %s (name=%s)", e.expected, e.Name)
 }
 
+// InvalidValue is an error that indicates a value was well-formed but did
+// not satisfy a constraint declared in a field tag, e.g. flatpack:"max=10".
+type InvalidValue struct {
+	Name Key
+	// Rule is the constraint that was violated, e.g. "max=10".
+	Rule string
+}
+
+func (e *InvalidValue) Error() string {
+	return fmt.Sprintf("flatpack: invalid value; must satisfy %s (name=%s)", e.Rule, e.Name)
+}
+
+// ValidationFailed is an error that indicates the Validate or
+// ValidateContext method of a nested struct or custom field type failed.
+// Errors returned by the top-level struct are not wrapped.
+type ValidationFailed struct {
+	Name  Key
+	Cause error
+}
+
+func (e *ValidationFailed) Error() string {
+	return fmt.Sprintf(`flatpack: validation failed; (name=%s,cause="%s")`, e.Name, e.Cause.Error())
+}
+
+// Unwrap returns the error returned by the Validate method.
+func (e *ValidationFailed) Unwrap() error {
+	return e.Cause
+}
+
+// MissingValue is an error that indicates a field marked with the
+// flatpack:"required" field tag had no value in the data source.
+type MissingValue struct {
+	Name Key
+	// Empty means the value was set, but to the empty string, which isn't a
+	// value for fields of this type.
+	Empty bool
+}
+
+func (e *MissingValue) Error() string {
+	if e.Empty {
+		return fmt.Sprintf("flatpack: missing value; field is required but empty (name=%s)", e.Name)
+	}
+	return fmt.Sprintf("flatpack: missing value; field is required (name=%s)", e.Name)
+}
+
+// DeprecatedValue is an error that indicates a field was read from a
+// deprecated variable, by an Unmarshaller constructed with
+// WithStrictDeprecations.
+type DeprecatedValue struct {
+	Name Key
+	// Message says which variable is deprecated, and usually what to use
+	// instead.
+	Message string
+}
+
+func (e *DeprecatedValue) Error() string {
+	return fmt.Sprintf("flatpack: deprecated value; %s (name=%s)", e.Message, e.Name)
+}
+
+// ReferenceCycle is an error that indicates a value could not be expanded
+// because it refers to itself, directly or indirectly.
+type ReferenceCycle struct {
+	Name Key
+	// Cycle lists the variables involved, starting and ending with the
+	// same one.
+	Cycle []string
+}
+
+func (e *ReferenceCycle) Error() string {
+	return fmt.Sprintf("flatpack: reference cycle; %s (name=%s)", strings.Join(e.Cycle, " -> "), e.Name)
+}
+
 // NoReflection is an error that indicates something went wrong when reflecting
 // on an unmarshalling target. Generally, this is caused by trying to unmarshal
 // into a struct that has unexported fields (i.e. whose names begin with a
@@ -46,3 +120,44 @@ type NoReflection struct {
 func (e *NoReflection) Error() string {
 	return fmt.Sprintf("flatpack: reflection error; unexported field (name=%s)", e.Name)
 }
+
+// Errors is a list of errors that occurred while unmarshalling. Unmarshal
+// keeps going when it encounters a bad value, so that all of them can be
+// reported at once; if there was more than one, they are returned as Errors.
+type Errors []error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap returns the individual errors, for the benefit of errors.Is and
+// errors.As.
+func (e Errors) Unwrap() []error {
+	return e
+}
+
+// Append an error to the list, flattening nested lists and skipping nils.
+func (e Errors) add(err error) Errors {
+	if nested, ok := err.(Errors); ok {
+		return append(e, nested...)
+	} else if err != nil {
+		return append(e, err)
+	}
+	return e
+}
+
+// Return nil if there are no errors, the error itself if there is one, or
+// the whole list.
+func (e Errors) err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	}
+	return e
+}
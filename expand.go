@@ -0,0 +1,149 @@
+package flatpack
+
+import (
+	"context"
+	"strings"
+)
+
+// Expander is a Getter that expands references to other variables in the
+// values returned by another Getter:
+//
+//	DATABASE_URL=postgres://${DATABASE_USER}@${DATABASE_HOST}:${DATABASE_PORT:-5432}/app
+//
+// ${NAME} is replaced by the value of NAME, which is looked up in the same
+// source as a single-element Key and expanded in turn. ${NAME:-default} is
+// replaced by default if NAME has no value. $$ stands for a literal dollar
+// sign; any other dollar sign is left alone. A reference that (indirectly)
+// refers to itself causes a ReferenceCycle error.
+//
+// Expansion is opt-in; to expand values from the package-level data source:
+//
+//	flatpack.DataSource = flatpack.NewExpander(flatpack.DataSource)
+type Expander struct {
+	source Getter
+}
+
+// NewExpander returns an Expander that expands values from source.
+func NewExpander(source Getter) *Expander {
+	return &Expander{source: source}
+}
+
+// Get returns the value for name with all references expanded.
+func (e *Expander) Get(name Key) (string, error) {
+	value, _, err := e.Lookup(name)
+	return value, err
+}
+
+// Lookup implements Lookuper by expanding the value for name, if it is set.
+func (e *Expander) Lookup(name Key) (string, bool, error) {
+	value, ok, err := lookup(e.source, name)
+	if err != nil {
+		return "", false, err
+	}
+	value, err = e.expand(e.source.Get, name, value, []string{name.AsEnv()})
+	return value, ok, err
+}
+
+// GetProfile implements ProfileGetter by expanding the profile-specific value
+// for name. References are resolved against the same profile, falling back
+// on base values.
+func (e *Expander) GetProfile(profile string, name Key) (string, error) {
+	value, _, err := e.lookupProfile(profile, name)
+	return value, err
+}
+
+func (e *Expander) lookupProfile(profile string, name Key) (string, bool, error) {
+	value, ok, err := lookupProfile(e.source, profile, name)
+	if err != nil {
+		return "", false, err
+	}
+	value, err = e.expand(NewProfile(e.source, profile).Get, name, value, []string{name.AsEnv()})
+	return value, ok, err
+}
+
+// Describe implements Describer by asking the underlying source.
+func (e *Expander) Describe(name Key) string {
+	return describe(e.source, name)
+}
+
+// Changes implements Watchable by asking the underlying source, or by
+// polling if it isn't Watchable.
+func (e *Expander) Changes(ctx context.Context) <-chan struct{} {
+	if watchable, ok := e.source.(Watchable); ok {
+		return watchable.Changes(ctx)
+	}
+	return poll(ctx, WatchInterval)
+}
+
+// Expand the references in value, which was read for name, looking them up
+// with get. The stack lists the variables whose values are being expanded,
+// to detect cycles.
+func (e *Expander) expand(get func(Key) (string, error), name Key, value string, stack []string) (string, error) {
+	if !strings.Contains(value, "$") {
+		return value, nil
+	}
+
+	result := strings.Builder{}
+	for len(value) > 0 {
+		dollar := strings.IndexByte(value, '$')
+		if dollar < 0 {
+			result.WriteString(value)
+			break
+		}
+		result.WriteString(value[:dollar])
+		value = value[dollar:]
+
+		switch {
+		case strings.HasPrefix(value, "$$"):
+			result.WriteByte('$')
+			value = value[2:]
+		case strings.HasPrefix(value, "${") && closingBrace(value) > 0:
+			end := closingBrace(value)
+			ref, def, hasDefault := strings.Cut(value[2:end], ":-")
+			value = value[end+1:]
+
+			for _, seen := range stack {
+				if seen == ref {
+					return "", &ReferenceCycle{Name: name, Cycle: append(stack, ref)}
+				}
+			}
+			expanded, err := get(Key{ref})
+			if err != nil {
+				return "", err
+			}
+			if expanded == "" && hasDefault {
+				expanded = def
+			}
+			expanded, err = e.expand(get, name, expanded, append(stack[:len(stack):len(stack)], ref))
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(expanded)
+		default:
+			result.WriteByte('$')
+			value = value[1:]
+		}
+	}
+
+	return result.String(), nil
+}
+
+// Find the index of the brace that closes the reference at the start of
+// value, allowing for nested references in defaults. Return -1 if the
+// reference isn't closed.
+func closingBrace(value string) int {
+	depth := 0
+	for i := 0; i < len(value); i++ {
+		switch {
+		case strings.HasPrefix(value[i:], "${"):
+			depth++
+			i++
+		case value[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,70 @@
+package flatpack
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Expander", func() {
+	expand := func(env map[string]string, name string) (string, error) {
+		return NewExpander(stubEnvironment(env)).Get(Key{name})
+	}
+
+	It("leaves plain values alone", func() {
+		Expect(expand(map[string]string{"FOO": "foo"}, "FOO")).To(Equal("foo"))
+		Expect(expand(map[string]string{"FOO": "a $ b $1 ${open"}, "FOO")).To(Equal("a $ b $1 ${open"))
+	})
+
+	It("expands references", func() {
+		env := map[string]string{
+			"DATABASE_URL":  "postgres://${DATABASE_USER}@${DATABASE_HOST}:${DATABASE_PORT}/app",
+			"DATABASE_USER": "${USER}",
+			"USER":          "alice",
+			"DATABASE_HOST": "db1",
+			"DATABASE_PORT": "5432",
+		}
+		Expect(expand(env, "DATABASE_URL")).To(Equal("postgres://alice@db1:5432/app"))
+	})
+
+	It("supports defaults", func() {
+		env := map[string]string{
+			"URL":   "http://${HOST:-localhost}:${PORT:-${FALLBACK:-80}}",
+			"HOST":  "example.com",
+			"EMPTY": "${MISSING}",
+		}
+		Expect(expand(env, "URL")).To(Equal("http://example.com:80"))
+		Expect(expand(env, "EMPTY")).To(Equal(""))
+	})
+
+	It("escapes dollar signs", func() {
+		env := map[string]string{"PRICE": "$$5 for $${HOST}", "HOST": "nope"}
+		Expect(expand(env, "PRICE")).To(Equal("$5 for ${HOST}"))
+	})
+
+	It("detects cycles", func() {
+		env := map[string]string{"A": "${B}", "B": "x${C}", "C": "${A}", "SELF": "${SELF}"}
+		_, err := expand(env, "A")
+		cycle := &ReferenceCycle{}
+		Expect(errors.As(err, &cycle)).To(BeTrue())
+		Expect(cycle.Cycle).To(Equal([]string{"A", "B", "C", "A"}))
+		Expect(err.Error()).To(Equal("flatpack: reference cycle; A -> B -> C -> A (name=A)"))
+
+		_, err = expand(env, "SELF")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("allows the same reference more than once", func() {
+		env := map[string]string{"A": "${B}${B}", "B": "b"}
+		Expect(expand(env, "A")).To(Equal("bb"))
+	})
+
+	It("works as an Unmarshal data source", func() {
+		env := map[string]string{"FOO": "${NAME}", "NAME": "bar", "BAZ_BAR": "${NUM}", "NUM": "42"}
+		fx := simple{}
+		Expect(implementation{source: NewExpander(stubEnvironment(env))}.Unmarshal(&fx)).To(Succeed())
+		Expect(fx.Foo).To(Equal("bar"))
+		Expect(fx.Baz.Bar).To(Equal(42))
+	})
+})
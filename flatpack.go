@@ -1,6 +1,9 @@
 package flatpack
 
-import "os"
+import (
+	"context"
+	"os"
+)
 
 // Getter represents a read-only repository of key/value pairs where the keys
 // are ordered sequences of strings and the values are strings. It's analogous
@@ -12,16 +15,50 @@ type Getter interface {
 	Get(name Key) (string, error)
 }
 
+// Lookuper is a Getter that can tell a value that is set but empty from one
+// that isn't set at all, which Get reports in the same way: as the empty
+// string. If a data source implements Lookuper, Unmarshal treats an empty
+// value as a real value for string and slice fields, so that e.g. LOG_PREFIX=
+// sets a string to "" over its default.
+type Lookuper interface {
+	Getter
+	// Lookup returns the value for name and whether it is set.
+	Lookup(name Key) (string, bool, error)
+}
+
+// Look up the value for name in source, which counts as set if it isn't
+// empty unless source is a Lookuper.
+func lookup(source Getter, name Key) (string, bool, error) {
+	if lookuper, ok := source.(Lookuper); ok {
+		return lookuper.Lookup(name)
+	}
+	value, err := source.Get(name)
+	return value, value != "", err
+}
+
 // Validater represents an object that knows how to validate itself. If the
 // object you pass to Unmarshal implements this interface, flatpack will call
 // it for you and return the error if anything fails to validate.
 //
+// Nested structs, the targets of pointers and custom field types may also
+// implement Validater. flatpack calls them as they are populated (but not
+// for pointers that are left nil) and wraps their errors in a
+// ValidationFailed that records where the failure occurred.
+//
 // Note that this is a ValidatER (a thing that can Validate itself), not
 // a ValidatOR (a thing that knows how to validate other things).
 type Validater interface {
 	Validate() error
 }
 
+// ContextValidater is like Validater, but its method receives a context and
+// the key of the value being validated, which allows it to do bounded I/O or
+// to consult other configuration via SourceFromContext. If a value
+// implements both interfaces, only ValidateContext is called.
+type ContextValidater interface {
+	ValidateContext(ctx context.Context, name Key) error
+}
+
 // DataSource is the single source of configuration used for all calls to
 // flatpack's singleton interface. When someone calls flatpack.Unmarshal(),
 // the data comes from this source.
@@ -36,9 +73,13 @@ var DataSource Getter = &processEnvironment{os.LookupEnv}
 // that want to use the default data source (process environment) or
 // set a process-wide data source at startup.
 //
-// NOTE: flatpack currently lacks a public non-singleton interface, but it
-// would be easy to add by simply exporting flatpack.new() and
-// declaring an Unmarshaller interface.
+// For the non-singleton interface, see New.
 func Unmarshal(dest interface{}) error {
-	return new(DataSource).Unmarshal(dest)
+	return New(DataSource).Unmarshal(dest)
+}
+
+// UnmarshalContext is like Unmarshal, but passes ctx to the ValidateContext
+// method of any ContextValidater that it populates.
+func UnmarshalContext(ctx context.Context, dest interface{}) error {
+	return New(DataSource).UnmarshalContext(ctx, dest)
 }
@@ -0,0 +1,129 @@
+package flatpack
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Types that fuzzed struct fields may have, besides the composites built by
+// fuzzType.
+var fuzzTypes = []reflect.Type{
+	reflect.TypeOf(false),
+	reflect.TypeOf(int(0)),
+	reflect.TypeOf(int8(0)),
+	reflect.TypeOf(uint16(0)),
+	reflect.TypeOf(uintptr(0)),
+	reflect.TypeOf(float32(0)),
+	reflect.TypeOf(complex64(0)),
+	reflect.TypeOf(complex128(0)),
+	reflect.TypeOf(""),
+	reflect.TypeOf(Secret("")),
+	reflect.TypeOf(time.Duration(0)),
+	reflect.TypeOf([2]int{}),
+	reflect.TypeOf(map[string]int{}),
+	reflect.TypeOf(make(chan int)),
+	reflect.TypeOf(func() {}),
+	reflect.TypeOf((*interface{})(nil)).Elem(),
+	reflect.TypeOf((*error)(nil)).Elem(),
+	reflect.TypeOf(Optional[int]{}),
+	reflect.TypeOf(Optional[[]string]{}),
+	reflect.TypeOf(Optional[struct{ A int }]{}),
+	reflect.TypeOf([]Optional[float64]{}),
+	reflect.TypeOf([]map[string]int{}),
+	reflect.TypeOf([][]int{}),
+	reflect.TypeOf([][]*[]Optional[string]{}),
+	reflect.TypeOf(map[string]interface{}{}),
+	reflect.TypeOf([]struct{ A int }{}),
+}
+
+var fuzzTags = []string{
+	``,
+	`flatpack:"required"`,
+	`flatpack:"default=1"`,
+	`flatpack:"default=[\"a\",null]"`,
+	`flatpack:"ignore"`,
+	`flatpack:"bytes"`,
+	`flatpack:"percent"`,
+	`flatpack:"secret"`,
+	`flatpack:"ignoreempty"`,
+	`flatpack:"nonempty,min=1,max=3"`,
+	`flatpack:"oneof=a|b,url"`,
+	`flatpack:"min=x"`,
+	`flatpack:"json"`,
+	`flatpack:"json,default={}"`,
+}
+
+// Build a type from the shape, returning what remains of it. Bytes beyond
+// the simple types make structs, pointers and slices of what follows.
+func fuzzType(shape []byte, depth int) (reflect.Type, []byte) {
+	if len(shape) == 0 {
+		return fuzzTypes[0], shape
+	}
+	b := int(shape[0]) % (len(fuzzTypes) + 3)
+	shape = shape[1:]
+	if b < len(fuzzTypes) || depth > 3 {
+		return fuzzTypes[b%len(fuzzTypes)], shape
+	}
+	switch b - len(fuzzTypes) {
+	case 0:
+		return fuzzStruct(shape, depth+1)
+	case 1:
+		elem, rest := fuzzType(shape, depth+1)
+		return reflect.PointerTo(elem), rest
+	default:
+		elem, rest := fuzzType(shape, depth+1)
+		return reflect.SliceOf(elem), rest
+	}
+}
+
+// Build a struct of up to four fields from the shape.
+func fuzzStruct(shape []byte, depth int) (reflect.Type, []byte) {
+	if len(shape) == 0 {
+		return reflect.StructOf(nil), shape
+	}
+	n := int(shape[0]) % 5
+	shape = shape[1:]
+	fields := make([]reflect.StructField, 0, n)
+	for i := 0; i < n && len(shape) > 0; i++ {
+		tag := fuzzTags[int(shape[0])%len(fuzzTags)]
+		var typ reflect.Type
+		typ, shape = fuzzType(shape[1:], depth)
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("F%d", i),
+			Type: typ,
+			Tag:  reflect.StructTag(tag),
+		})
+	}
+	return reflect.StructOf(fields), shape
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	f.Add([]byte{4, 0, 1, 1, 6, 2, 7, 3, 8}, "1+2i\n42\n\n[1,2]")
+	f.Add([]byte{3, 12, 13, 1, 14, 2, 15}, "x")
+	f.Add([]byte{4, 5, 24, 3, 1, 2, 6, 25, 26, 4, 9, 17, 10, 19}, "[null]\n50%\n1KiB")
+	f.Add([]byte{2, 1, 26, 26, 25, 3, 2, 21, 0, 22}, `[[1],["x"]]`+"\n{}")
+	f.Fuzz(func(t *testing.T, shape []byte, values string) {
+		typ, _ := fuzzStruct(shape, 0)
+		choices := strings.Split(values, "\n")
+		source := processEnvironment{func(name string) (string, bool) {
+			i := len(name) % (len(choices) + 1)
+			if i == len(choices) {
+				return "", false
+			}
+			return choices[i], true
+		}}
+
+		config := reflect.New(typ).Interface()
+		New(source).Unmarshal(config)
+		New(source, WithLenientBools(nil, nil)).UnmarshalWithReport(config)
+		Marshal(config)
+		MarshalDotenv(io.Discard, config)
+		Variables(config)
+		Schema(config)
+		Redacted(config)
+	})
+}
@@ -0,0 +1,152 @@
+package flatpack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// GeneratedUnmarshaller is implemented by config structs that have an
+// UnmarshalFlatpack method generated by flatpack-gen:
+//
+//	//go:generate flatpack-gen -type Config
+//
+// Unmarshal calls that method instead of using reflection, except when it
+// needs to do something the method can't: report provenance, pass a context
+// to validaters, or accept lenient booleans.
+type GeneratedUnmarshaller interface {
+	UnmarshalFlatpack(source Getter) error
+}
+
+// Fields helps methods generated by flatpack-gen to read values with exactly
+// the same semantics as Unmarshal. It isn't meant to be used by hand.
+type Fields struct {
+	source Getter
+	count  int
+	errs   Errors
+}
+
+// NewFields returns a Fields that reads values from source.
+func NewFields(source Getter) *Fields {
+	return &Fields{source: source}
+}
+
+// Get returns the value for name, or def if the source has none and
+// hasDefault is true. It returns false if there is no value, recording a
+// MissingValue if the field is required. If empty is true, a value that is
+// set but empty counts.
+func (fs *Fields) Get(name Key, required, hasDefault, empty bool, def string) (string, bool) {
+	got, set, _, err := implementation{source: fs.source}.get(name, "", tags{required: required, hasDefault: hasDefault, def: def}, empty)
+	fs.Fail(err, "", false)
+	return got, err == nil && set
+}
+
+// Elements splits a JSON array into the string representations of its
+// elements. The empty string stands for an empty array.
+func (fs *Fields) Elements(got string) ([]string, error) {
+	return splitJSON(got)
+}
+
+// ParseInt parses an integer the way Unmarshal does: like strconv.ParseInt,
+// but with Go's base prefixes and underscores.
+func (fs *Fields) ParseInt(s string, bitSize int) (int64, error) {
+	return parseInt(s, bitSize)
+}
+
+// ParseUint parses an unsigned integer the way Unmarshal does.
+func (fs *Fields) ParseUint(s string, bitSize int) (uint64, error) {
+	return parseUint(s, bitSize)
+}
+
+// ParseBytes parses a number of bytes with an optional unit, e.g. 512MiB,
+// the way Unmarshal does for fields with the bytes tag.
+func (fs *Fields) ParseBytes(s string, bitSize int) (uint64, error) {
+	return parseBytes(s, bitSize)
+}
+
+// ParsePercent parses a percentage, e.g. 50%, as a fraction, the way
+// Unmarshal does for fields with the percent tag.
+func (fs *Fields) ParsePercent(s string, bitSize int) (float64, error) {
+	return parsePercent(s, bitSize)
+}
+
+// Count records that n values were read.
+func (fs *Fields) Count(n int) {
+	fs.count += n
+}
+
+// Counted returns the number of values read so far.
+func (fs *Fields) Counted() int {
+	return fs.count
+}
+
+// Fail records an error, if it isn't nil. If the field is secret, its raw
+// value is masked in the error.
+func (fs *Fields) Fail(err error, raw string, secret bool) {
+	if secret {
+		err = redactError(err, raw)
+	}
+	fs.errs = fs.errs.add(err)
+}
+
+// Failures returns the number of errors recorded so far.
+func (fs *Fields) Failures() int {
+	return len(fs.errs)
+}
+
+// Match determines whether a formatted value satisfies a rule that isn't
+// about length, e.g. "oneof=debug|info".
+func (fs *Fields) Match(rule, value string) bool {
+	r, ok := matchers.Load(rule)
+	if !ok {
+		name, arg, _ := strings.Cut(rule, "=")
+		parsed, err := newRule(name, arg)
+		if err != nil || parsed.match == nil {
+			return false
+		}
+		r, _ = matchers.LoadOrStore(rule, parsed.match)
+	}
+	return r.(func(string) bool)(value)
+}
+
+// Rules that have been parsed on behalf of Fields.Match.
+var matchers sync.Map
+
+// Validate calls the Validate or ValidateContext method of target, if it has
+// one, in the same way as Unmarshal.
+func (fs *Fields) Validate(name Key, target interface{}) error {
+	return callValidater(context.Background(), fs.source, name, target)
+}
+
+// Err returns the errors recorded so far, in the same form as Unmarshal.
+func (fs *Fields) Err() error {
+	return fs.errs.err()
+}
+
+// TagOption is one of the options of a flatpack field tag, such as
+// {"default", "localhost"} or {"min", "1"}.
+type TagOption struct {
+	Name, Value string
+}
+
+// ParseTag splits a flatpack field tag into options in the same way as
+// Unmarshal. It fails if the tag has an unknown option or declares a
+// malformed rule.
+func ParseTag(tag string) ([]TagOption, error) {
+	split, err := splitTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	var options []TagOption
+	for _, option := range split {
+		name, value := option[0], option[1]
+		if _, isRule := ruleOptions[name]; isRule {
+			if r, err := newRule(name, value); err != nil {
+				return nil, fmt.Errorf("%s: %s", r, err)
+			}
+		}
+		options = append(options, TagOption{Name: name, Value: value})
+	}
+	return options, nil
+}
@@ -0,0 +1,122 @@
+package flatpack
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// For testing that Unmarshal prefers generated methods
+type pregenerated struct {
+	Foo       string
+	generated bool `flatpack:"ignore"`
+}
+
+func (p *pregenerated) UnmarshalFlatpack(source Getter) error {
+	p.generated = true
+	fs := NewFields(source)
+	if got, ok := fs.Get(Key{"Foo"}, false, false, true, ""); ok {
+		p.Foo = got
+	}
+	return fs.Err()
+}
+
+var _ = Describe("GeneratedUnmarshaller", func() {
+	env := map[string]string{"FOO": "foo"}
+
+	It("is preferred to reflection", func() {
+		fx := pregenerated{}
+		Expect(New(stubEnvironment(env)).Unmarshal(&fx)).To(Succeed())
+		Expect(fx.generated).To(BeTrue())
+		Expect(fx.Foo).To(Equal("foo"))
+	})
+
+	It("isn't used when a report, context, lenient booleans or logs are needed", func() {
+		fx := pregenerated{}
+		report, err := New(stubEnvironment(env)).UnmarshalWithReport(&fx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fx.generated).To(BeFalse())
+		Expect(report).To(HaveLen(1))
+
+		fx = pregenerated{}
+		Expect(New(stubEnvironment(env)).UnmarshalContext(context.Background(), &fx)).To(Succeed())
+		Expect(fx.generated).To(BeFalse())
+		Expect(fx.Foo).To(Equal("foo"))
+
+		fx = pregenerated{}
+		Expect(New(stubEnvironment(env), WithLenientBools(nil, nil)).Unmarshal(&fx)).To(Succeed())
+		Expect(fx.generated).To(BeFalse())
+
+		fx = pregenerated{}
+		Expect(New(stubEnvironment(env), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))).Unmarshal(&fx)).To(Succeed())
+		Expect(fx.generated).To(BeFalse())
+	})
+
+	It("isn't called with a nil receiver", func() {
+		var fx *pregenerated
+		err := New(stubEnvironment(env)).Unmarshal(fx)
+		Expect(err).To(BeAssignableToTypeOf(&BadValue{}))
+	})
+})
+
+var _ = Describe("Fields", func() {
+	var fs *Fields
+
+	BeforeEach(func() {
+		fs = NewFields(stubEnvironment(map[string]string{"FOO": "foo"}))
+	})
+
+	It("reads values like Unmarshal", func() {
+		got, ok := fs.Get(Key{"Foo"}, true, false, false, "")
+		Expect(got).To(Equal("foo"))
+		Expect(ok).To(BeTrue())
+		got, ok = fs.Get(Key{"Bar"}, false, true, false, "bar")
+		Expect(got).To(Equal("bar"))
+		Expect(ok).To(BeTrue())
+		_, ok = fs.Get(Key{"Baz"}, false, false, false, "")
+		Expect(ok).To(BeFalse())
+		Expect(fs.Err()).NotTo(HaveOccurred())
+
+		_, ok = fs.Get(Key{"Baz"}, true, false, false, "")
+		Expect(ok).To(BeFalse())
+		Expect(fs.Err()).To(MatchError(&MissingValue{Name: Key{"Baz"}}))
+	})
+
+	It("masks secrets in errors", func() {
+		fs.Fail(&BadValue{Name: Key{"Foo"}, Cause: errors.New(`bad "hush"`)}, "hush", true)
+		fs.Fail(nil, "", false)
+		Expect(fs.Failures()).To(Equal(1))
+		Expect(fs.Err()).NotTo(MatchError(ContainSubstring("hush")))
+	})
+
+	It("matches rules", func() {
+		Expect(fs.Match("oneof=a|b", "b")).To(BeTrue())
+		Expect(fs.Match("oneof=a|b", "c")).To(BeFalse())
+		Expect(fs.Match("hostname", "example.com")).To(BeTrue())
+		Expect(fs.Match("pattern=[", "x")).To(BeFalse())
+	})
+})
+
+var _ = Describe("ParseTag", func() {
+	It("splits options", func() {
+		Expect(ParseTag("required,desc=a, b,oneof=x|y")).To(Equal([]TagOption{
+			{Name: "required"},
+			{Name: "desc", Value: "a, b"},
+			{Name: "oneof", Value: "x|y"},
+		}))
+	})
+
+	It("rejects malformed rules", func() {
+		_, err := ParseTag("min=low")
+		Expect(err).To(MatchError(HavePrefix("min=low: ")))
+	})
+
+	It("rejects unknown options", func() {
+		_, err := ParseTag("secret,defualt=x")
+		Expect(err).To(MatchError(`unknown option "defualt"`))
+	})
+})
@@ -1,140 +1,502 @@
 package flatpack
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"reflect"
 	"strconv"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 )
 
-// Unexported implementation class for unmarshaller.
+// Unexported implementation class for Unmarshaller.
 type implementation struct {
 	source Getter
+	// report, if not nil, receives the provenance of every field that is set
+	report *Report
+	// ctx is passed to ContextValidaters; nil means context.Background()
+	ctx context.Context
+	// profile is the name of the active profile, if any; profileKey, if not
+	// nil, names the key that selects a different one
+	profile    string
+	profileKey Key
+	// bools maps the words that WithLenientBools accepts, in lower case, to
+	// their values
+	bools map[string]bool
+	// deprecated, if not nil, is told when a field is read from a variable
+	// that is on its way out; strict makes that an error instead
+	deprecated func(name Key, message string)
+	strict     bool
+	// logger, if not nil, is told about every key that is looked up
+	logger *slog.Logger
 }
 
 // Unmarshal reads configuration data from some source into a struct.
 func (f implementation) Unmarshal(dest interface{}) error {
-	_, err := f.unmarshal(Key{}, dest)
+	if f.profileKey != nil {
+		profile, err := f.source.Get(f.profileKey)
+		if err != nil {
+			return err
+		}
+		if profile != "" {
+			f.profile = profile
+		}
+	}
+	if f.profile != "" {
+		f.source = NewProfile(f.source, f.profile)
+	}
+	// prefer a generated method, unless we need it to do more than it can
+	if generated, ok := dest.(GeneratedUnmarshaller); ok && f.report == nil && f.ctx == nil && f.bools == nil && f.logger == nil {
+		if v := reflect.ValueOf(dest); v.Kind() != reflect.Ptr || !v.IsNil() {
+			return generated.UnmarshalFlatpack(f.source)
+		}
+	}
+	_, err := f.unmarshal(dest)
 	return err
 }
 
-// Read configuration source into a struct or sub-struct. Return the number of
-// fields that were set.
-func (f implementation) unmarshal(prefix Key, dest interface{}) (int, error) {
-	count := 0
+// UnmarshalContext reads configuration data from some source into a struct,
+// passing ctx to any ContextValidater that it encounters.
+func (f implementation) UnmarshalContext(ctx context.Context, dest interface{}) error {
+	f.ctx = ctx
+	return f.Unmarshal(dest)
+}
+
+// Read configuration source into a struct and validate it. Return the number
+// of fields that were set.
+func (f implementation) unmarshal(dest interface{}) (int, error) {
 	v := reflect.ValueOf(dest)
 	if v.Kind() == reflect.Ptr {
 		if v.IsNil() {
-			return 0, &BadValue{Name: prefix, expected: "non-nil pointer to struct"}
+			return 0, &BadValue{Name: Key{}, expected: "non-nil pointer to struct"}
 		}
 		v = v.Elem()
 	} else {
-		return 0, &BadType{Name: prefix, Kind: v.Kind(), reason: "expected pointer to struct"}
+		return 0, &BadType{Name: Key{}, Kind: v.Kind(), reason: "expected pointer to struct"}
+	}
+
+	if v.Kind() != reflect.Struct {
+		return 0, &BadType{Name: Key{}, Kind: v.Kind(), reason: "expected struct"}
+	}
+
+	count, err := f.fill(planFor(v.Type()), v)
+	if err == nil {
+		err = f.validate(Key{}, v)
+	}
+	f.summarize(v.Type(), count, err)
+	return count, err
+}
+
+// Read configuration source into the fields of a struct or sub-struct
+// according to its plan, but don't validate the struct itself. Return the
+// number of fields that were set.
+func (f implementation) fill(p *plan, v reflect.Value) (int, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+
+	// keep going after bad values so we can report all of them at once
+	var errs Errors
+
+	count := 0
+	counts := make([]int, len(p.fields))
+	for i := range p.fields {
+		fp := &p.fields[i]
+		value, _ := fieldByIndex(v, fp.field.Index, true)
+		read, err := f.read(fp, value)
+		errs = errs.add(err)
+		counts[i] = read
+		count += read
+	}
+
+	// Set embedded pointers (back) to nil if no values were read through
+	// them, like pointer fields.
+	for _, path := range p.embedded {
+		read := 0
+		for i := range p.fields {
+			if index := p.fields[i].field.Index; len(index) > len(path) && reflect.DeepEqual(index[:len(path)], path) {
+				read += counts[i]
+			}
+		}
+		if value, ok := fieldByIndex(v, path, false); ok && read == 0 {
+			value.Set(reflect.Zero(value.Type()))
+		}
+	}
+
+	return count, errs.err()
+}
+
+// Enumerate the fields of a struct type that flatpack should process, i.e.
+// all exported fields that are not marked with the ignore tag. Unexported
+// fields that aren't ignored cause a NoReflection error.
+//
+// The fields of embedded structs are promoted as in Go: they take the place
+// of the embedded struct, are named as if they belonged to the embedding
+// struct, and are hidden by fields of the same name at a shallower depth.
+// Their Index is the full path from vt. Embedding an unexported struct type
+// is fine, because its exported fields can still be set, but embedding a
+// pointer to one is not. Embedded structs with the prefix tag are treated
+// like any other field.
+//
+// Both reading and writing use this, which guarantees that they agree about
+// which fields make up the configuration.
+func fieldsOf(prefix Key, vt reflect.Type) ([]reflect.StructField, error) {
+	candidates, err := collectFields(prefix, vt, nil, 0, map[reflect.Type]bool{})
+	if err != nil {
+		return nil, err
 	}
 
-	vt := v.Type()
+	// a field is visible if it is the only one of its name at the shallowest
+	// depth at which the name occurs
+	shallowest := make(map[string]int, len(candidates))
+	count := make(map[string]int, len(candidates))
+	for _, c := range candidates {
+		if depth, ok := shallowest[c.Name]; !ok || c.depth < depth {
+			shallowest[c.Name], count[c.Name] = c.depth, 1
+		} else if c.depth == depth {
+			count[c.Name]++
+		}
+	}
 
-	if vt.Kind() != reflect.Struct {
-		return 0, &BadType{Name: prefix, Kind: vt.Kind(), reason: "expected struct"}
+	fields := make([]reflect.StructField, 0, len(candidates))
+	for _, c := range candidates {
+		if c.depth == shallowest[c.Name] && count[c.Name] == 1 {
+			fields = append(fields, c.StructField)
+		}
 	}
+	return fields, nil
+}
 
-	// prepare a reusable key whose last element will change as we iterate
-	// through the fields in this struct
-	name := make(Key, len(prefix)+1)
-	copy(name, prefix)
+// A field that may be promoted from an embedded struct, and the depth at
+// which it is embedded.
+type candidate struct {
+	reflect.StructField
+	depth int
+}
+
+// Enumerate the fields of a struct type, and those of its embedded structs,
+// on behalf of fieldsOf. The index is the path to vt from the outermost
+// struct and visiting holds the embedded types that enclose it.
+func collectFields(prefix Key, vt reflect.Type, index []int, depth int, visiting map[reflect.Type]bool) ([]candidate, error) {
+	visiting[vt] = true
+	defer delete(visiting, vt)
 
+	candidates := make([]candidate, 0, vt.NumField())
 	for i := 0; i < vt.NumField(); i++ {
 		field := vt.Field(i)
-		value := v.Field(i)
-
+		if canIgnore(&field) {
+			continue
+		}
+		field.Index = append(index[:len(index):len(index)], i)
 		letter, _ := utf8.DecodeRuneInString(field.Name)
-		if !unicode.IsUpper(letter) {
-			if f.canIgnore(&field) {
+		exported := unicode.IsUpper(letter)
+
+		if embedded := promoted(&field); embedded != nil {
+			if field.Type.Kind() == reflect.Ptr && !exported {
+				return nil, &NoReflection{Name: append(prefix[:len(prefix):len(prefix)], field.Name)}
+			}
+			if visiting[embedded] {
 				continue
-			} else {
-				return 0, &NoReflection{Name: name}
 			}
+			promoted, err := collectFields(prefix, embedded, field.Index, depth+1, visiting)
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, promoted...)
+			continue
 		}
 
-		name[len(name)-1] = field.Name
-		read, err := f.read(name, &field, value)
-		if err != nil {
-			return 0, err
+		if !exported {
+			return nil, &NoReflection{Name: append(prefix[:len(prefix):len(prefix)], field.Name)}
 		}
-		count += read
+		candidates = append(candidates, candidate{field, depth})
 	}
+	return candidates, nil
+}
 
-	validater, ok := dest.(Validater)
-	if ok {
-		return count, validater.Validate()
+// Return the struct type whose fields are promoted through a field, if it
+// is an embedded struct or pointer to struct without the prefix or json tag.
+func promoted(field *reflect.StructField) reflect.Type {
+	if tags := parseTags(field); !field.Anonymous || tags.prefix || tags.json {
+		return nil
+	}
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
 	}
+	return t
+}
 
-	return count, nil
+// Find the embedded pointers that lie on the paths to a struct's fields, as
+// returned by fieldsOf. Outer pointers precede the ones they lead to.
+func embeddedPointers(vt reflect.Type, fields []reflect.StructField) [][]int {
+	var paths [][]int
+	seen := map[string]bool{}
+	for _, field := range fields {
+		t := vt
+		for depth, i := range field.Index[:len(field.Index)-1] {
+			embedded := t.Field(i).Type
+			if embedded.Kind() == reflect.Ptr {
+				path := field.Index[:depth+1]
+				if id := fmt.Sprint(path); !seen[id] {
+					seen[id] = true
+					paths = append(paths, path)
+				}
+				embedded = embedded.Elem()
+			}
+			t = embedded
+		}
+	}
+	return paths
 }
 
-func (f implementation) canIgnore(field *reflect.StructField) bool {
-	tag := field.Tag.Get("flatpack")
-	return tag == "ignore"
+// Return the field of a struct with the given index path, like
+// reflect.Value.FieldByIndex. If the path passes through a nil embedded
+// pointer, allocate it if alloc is true; otherwise return false.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
 }
 
-// Coerce a string to a suitable Type and then assign it to a Value (either a
-// struct field or an element of a slice).
-func (f implementation) assign(dest reflect.Value, source string, name Key) (err error) {
-	kind := dest.Type().Kind()
+// Determine whether a field isn't part of the configuration, because it has
+// the ignore tag or holds something that can't be read from a string:
+// a channel, function or interface, unless the json tag says otherwise.
+func canIgnore(field *reflect.StructField) bool {
+	tags := parseTags(field)
+	switch field.Type.Kind() {
+	case reflect.Interface, reflect.Chan, reflect.Func:
+		return !tags.json
+	}
+	return tags.ignore
+}
 
+// Determine whether values of the given kind are read from a single string,
+// as opposed to being containers for other fields.
+func isScalar(kind reflect.Kind) bool {
 	switch kind {
-	case reflect.Bool:
-		var boolean bool
-		boolean, err = strconv.ParseBool(source)
-		if err == nil {
-			dest.SetBool(boolean)
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Uintptr, reflect.Float32,
+		reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.String:
+		return true
+	}
+	return false
+}
+
+// A visitor is called by walk() for every field that is read from a single
+// key of the data source.
+type visitor func(name Key, field *reflect.StructField, value reflect.Value) error
+
+// Visit every field of a struct value that Unmarshal would read from the
+// data source, in the same order and under the same names. Fields that are
+// structs or pointers are traversed rather than visited, unless they have
+// the json tag. Nil pointers are traversed as if they pointed to a zero
+// value if zeroNil is true; otherwise they are skipped.
+//
+// The traversal follows the struct's plan, so it never disagrees with
+// read() about which keys make up the configuration, and fails where read()
+// would fail on account of the type, e.g. because it is recursive. Code that
+// needs to know those keys should use this.
+func walk(v reflect.Value, zeroNil bool, visit visitor) error {
+	return walkPlan(planFor(v.Type()), v, zeroNil, visit)
+}
+
+func walkPlan(p *plan, v reflect.Value, zeroNil bool, visit visitor) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	for i := range p.fields {
+		fp := &p.fields[i]
+		value, ok := fieldByIndex(v, fp.field.Index, false)
+		if !ok && !zeroNil {
+			continue
+		} else if !ok {
+			value = reflect.Zero(fp.field.Type)
+		}
+		if err := walkField(fp, value, zeroNil, visit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func walkField(fp *fieldPlan, value reflect.Value, zeroNil bool, visit visitor) error {
+	if inner := optionalElem(value.Type()); inner != nil {
+		// Optional values are traversed like pointers
+		if fp.optional.plan != nil {
+			return &BadType{Name: fp.name, Kind: reflect.Struct, reason: "unsupported optional type"}
+		}
+		if elem, set := optionalValue(value); set {
+			return walkField(fp.optional, elem, zeroNil, visit)
+		} else if zeroNil {
+			return walkField(fp.optional, reflect.Zero(inner), zeroNil, visit)
+		}
+		return nil
+	}
+	kind := value.Kind()
+	switch {
+	case kind == reflect.Ptr:
+		if !value.IsNil() {
+			return walkField(fp, value.Elem(), zeroNil, visit)
+		} else if zeroNil {
+			return walkField(fp, reflect.Zero(value.Type().Elem()), zeroNil, visit)
 		}
+		return nil
+	case isScalar(kind), kind == reflect.Slice, fp.tags.json:
+		// the plan's names must not be modified, so visitors get a copy
+		return visit(append(Key{}, fp.name...), &fp.field, value)
+	case kind == reflect.Struct:
+		return walkPlan(fp.plan, value, zeroNil, visit)
+	default:
+		return &BadType{Name: fp.name, Kind: kind, reason: "unsupported data type"}
+	}
+}
+
+// Coerce a string to a suitable Type and then assign it to a Value (either a
+// struct field or an element of a slice).
+func (f implementation) assign(dest reflect.Value, source string, name Key) error {
+	return decoderFor(dest.Kind(), tags{})(f, dest, source, name)
+}
+
+// Refuse to decode a string into a value of a kind that isn't scalar, e.g.
+// an element of a slice of maps.
+func (f implementation) decodeUnsupported(dest reflect.Value, source string, name Key) error {
+	return &BadType{Name: name, Kind: dest.Kind(), reason: "unsupported data type"}
+}
+
+func (f implementation) decodeBool(dest reflect.Value, source string, name Key) error {
+	boolean, err := parseBool(source, f.bools)
+	if err != nil {
+		return &BadValue{Name: name, Cause: err}
+	}
+	dest.SetBool(boolean)
+	return nil
+}
+
+func (f implementation) decodeInt(dest reflect.Value, source string, name Key) error {
+	number, err := parseInt(source, int(dest.Type().Size()*8))
+	if err != nil {
+		return &BadValue{Name: name, Cause: err}
+	}
+	dest.SetInt(number)
+	return nil
+}
+
+func (f implementation) decodeUint(dest reflect.Value, source string, name Key) error {
+	number, err := parseUint(source, int(dest.Type().Size()*8))
+	if err != nil {
+		return &BadValue{Name: name, Cause: err}
+	}
+	dest.SetUint(number)
+	return nil
+}
+
+func (f implementation) decodeFloat(dest reflect.Value, source string, name Key) error {
+	number, err := strconv.ParseFloat(source, int(dest.Type().Size()*8))
+	if err != nil {
+		return &BadValue{Name: name, Cause: err}
+	}
+	dest.SetFloat(number)
+	return nil
+}
+
+// Decode a number of bytes with an optional unit into a numeric field.
+func (f implementation) decodeBytes(dest reflect.Value, source string, name Key) error {
+	bits := int(dest.Type().Size() * 8)
+	switch dest.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		var number int64
-		number, err = strconv.ParseInt(source, 10, int(dest.Type().Size()*8))
-		if err == nil {
-			dest.SetInt(number)
-		} else {
-			numError, ok := err.(*strconv.NumError)
-			if ok {
-				err = &BadValue{Name: name, Cause: numError}
-			}
+		number, err := parseBytes(source, bits-1)
+		if err != nil {
+			return &BadValue{Name: name, Cause: err}
 		}
+		dest.SetInt(int64(number))
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
 		reflect.Uint64, reflect.Uintptr:
-		var number uint64
-		number, err = strconv.ParseUint(source, 10, int(dest.Type().Size()*8))
-		if err == nil {
-			dest.SetUint(number)
-		} else {
-			numError, ok := err.(*strconv.NumError)
-			if ok {
-				err = &BadValue{Name: name, Cause: numError}
-			}
+		number, err := parseBytes(source, bits)
+		if err != nil {
+			return &BadValue{Name: name, Cause: err}
 		}
+		dest.SetUint(number)
 	case reflect.Float32, reflect.Float64:
-		var number float64
-		number, err = strconv.ParseFloat(source, int(dest.Type().Size()*8))
-		if err == nil {
-			dest.SetFloat(number)
-		} else {
-			numError, ok := err.(*strconv.NumError)
-			if ok {
-				err = &BadValue{Name: name, Cause: numError}
-			}
-		}
-	case reflect.String:
-		if err == nil {
-			dest.SetString(source)
+		number, err := parseBytes(source, 64)
+		if err != nil {
+			return &BadValue{Name: name, Cause: err}
 		}
+		dest.SetFloat(float64(number))
 	default:
-		// should be unreachable due to validation in read()
-		panic(fmt.Errorf("flatpack: unreachable code in assign(); bug in read()? (kind=%s)", kind))
+		return &BadType{Name: name, Kind: dest.Kind(), reason: "bytes needs a numeric field"}
 	}
+	return nil
+}
 
-	return
+// Decode a percentage into a floating-point field, as a fraction.
+func (f implementation) decodePercent(dest reflect.Value, source string, name Key) error {
+	if dest.Kind() != reflect.Float32 && dest.Kind() != reflect.Float64 {
+		return &BadType{Name: name, Kind: dest.Kind(), reason: "percent needs a floating-point field"}
+	}
+	number, err := parsePercent(source, int(dest.Type().Size()*8))
+	if err != nil {
+		return &BadValue{Name: name, Cause: err}
+	}
+	dest.SetFloat(number)
+	return nil
+}
+
+func (f implementation) decodeComplex(dest reflect.Value, source string, name Key) error {
+	number, err := strconv.ParseComplex(source, int(dest.Type().Size()*8))
+	if err != nil {
+		return &BadValue{Name: name, Cause: err}
+	}
+	dest.SetComplex(number)
+	return nil
+}
+
+func (f implementation) decodeString(dest reflect.Value, source string, name Key) error {
+	dest.SetString(source)
+	return nil
+}
+
+var errTrailingJSON = errors.New("invalid data after top-level JSON value")
+
+// Unmarshal a JSON document into a field with the json tag, replacing its
+// value. Numbers that end up in interfaces are json.Number rather than
+// float64, so that large integers keep their precision.
+func (f implementation) decodeJSON(dest reflect.Value, source string, name Key) error {
+	decoder := json.NewDecoder(strings.NewReader(source))
+	decoder.UseNumber()
+	target := reflect.New(dest.Type())
+	err := decoder.Decode(target.Interface())
+	if err == nil {
+		if _, extra := decoder.Token(); extra != io.EOF {
+			err = errTrailingJSON
+		}
+	}
+	if err != nil {
+		return &BadValue{Name: name, Cause: err}
+	}
+	dest.Set(target.Elem())
+	return nil
 }
 
 // Set a single struct field by reading a string from the Getter, massaging it
@@ -145,69 +507,223 @@ func (f implementation) assign(dest reflect.Value, source string, name Key) (err
 // recursively read into the pointed-to value.
 //
 // Return the number of fields that were set.
-func (f implementation) read(name Key, field *reflect.StructField, value reflect.Value) (int, error) {
+func (f implementation) read(fp *fieldPlan, value reflect.Value) (int, error) {
 	count := 0
 	vt := value.Type()
 	kind := vt.Kind()
 
 	var got string
+	var set, fromDefault bool
 	var err error
 
-	switch kind {
-	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
-		reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
-		reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64,
-		reflect.String:
-		got, err = f.source.Get(name)
-		if err == nil && got != "" {
-			err = f.assign(value, got, name)
+	name, tags := fp.name, fp.tags
+	if fp.optional != nil && kind == reflect.Struct {
+		return f.readOptional(fp.optional, value)
+	}
+
+	switch {
+	case tags.json && fp.optional == nil, isScalar(kind):
+		got, set, fromDefault, err = f.get(name, fp.env, tags, fp.empty)
+		f.trace(name, tags, vt, got, set, fromDefault)
+		if err == nil && set {
+			err = fp.decode(f, value, got, name)
+			if err == nil {
+				err = f.check(name, tags, value)
+			}
+			if err == nil {
+				err = f.validate(name, value)
+			}
 			count++
 		}
-	case reflect.Slice:
-		got, err = f.source.Get(name)
-		if err == nil && got != "" {
-			var raw []interface{}
-			err = json.Unmarshal([]byte(got), &raw)
+	case kind == reflect.Slice:
+		got, set, fromDefault, err = f.get(name, fp.env, tags, fp.empty)
+		f.trace(name, tags, vt, got, set, fromDefault)
+		if err == nil && set {
+			var elems []string
+			var nulls []bool
+			elems, nulls, err = splitNullableJSON(got)
 			if err == nil {
-				vte := value.Type().Elem()
-				value.Set(reflect.MakeSlice(vt, len(raw), len(raw)))
-				for i, elem := range raw {
-					if err == nil {
-						vi := value.Index(i)
-						if vte.Kind() == reflect.Ptr {
-							vi.Set(reflect.New(vte.Elem()))
-							vi = vi.Elem()
-						}
-						err = f.assign(vi, fmt.Sprintf("%v", elem), name)
-						count++
-					}
+				err = f.decodeElems(value, elems, nulls, fp.elemOptional, fp.decode, name)
+				if err == nil {
+					err = f.check(name, tags, value)
+				}
+				if err == nil {
+					err = f.validate(name, value)
 				}
 			}
+			// a slice is one value, even if it has no elements
+			count++
+		}
+	case kind == reflect.Struct:
+		count, err = f.fill(fp.plan, value)
+		if err == nil && count == 0 && tags.required {
+			err = &MissingValue{Name: name}
+		}
+		if err == nil {
+			err = f.validate(name, value)
 		}
-	case reflect.Struct:
-		addr := value.Addr()
-		if addr.CanInterface() {
-			count, err = f.unmarshal(name, addr.Interface())
-		} // else if !f.canIgnore(field) {
-		//	err = &NoReflection{Name: name}
-		//}
-	case reflect.Ptr:
+	case kind == reflect.Ptr:
 		// Handle pointers by allocating if necessary, then recursively calling
 		// ourselves.
 		if value.IsNil() {
 			value.Set(reflect.New(value.Type().Elem()))
 		}
-		count, err = f.read(name, field, value.Elem())
+		elem := value.Elem()
+		if elem.Kind() == reflect.Struct && fp.optional == nil {
+			// don't validate the struct unless we keep it
+			count, err = f.fill(fp.plan, elem)
+			if err == nil && count == 0 && tags.required {
+				err = &MissingValue{Name: name}
+			}
+			if err == nil && count > 0 {
+				err = f.validate(name, elem)
+			}
+		} else {
+			count, err = f.read(fp, elem)
+		}
 		// Set pointer (back) to nil if no values were read into it; prevent
 		// fooling client into thinking he got nested values when he did not.
 		if count == 0 {
 			value.Set(reflect.Zero(value.Type()))
 		}
 	default:
-		if !f.canIgnore(field) {
+		if !tags.ignore {
 			err = &BadType{Name: name, Kind: value.Kind(), reason: "unsupported data type"}
 		}
 	}
 
+	if err == nil && set {
+		f.record(name, tags, fromDefault, got, value.Interface())
+	} else if tags.secret {
+		err = redactError(err, got)
+	}
+
 	return count, err
 }
+
+// Read the value held by an Optional field, marking it as set if there is
+// one and unsetting it otherwise, like a pointer.
+func (f implementation) readOptional(fp *fieldPlan, value reflect.Value) (int, error) {
+	if fp.plan != nil {
+		return 0, &BadType{Name: fp.name, Kind: reflect.Struct, reason: "unsupported optional type"}
+	}
+	count, err := f.read(fp, optionalTarget(value))
+	if count == 0 {
+		value.Addr().Interface().(optional).reset()
+	} else {
+		value.Addr().Interface().(optional).mark(append(Key{}, fp.name...))
+	}
+	return count, err
+}
+
+// Decode the elements of a JSON array, as split by splitNullableJSON, into a
+// new slice that replaces the value of dest. Elements that are pointers are
+// allocated; null elements are left unset if they are Optional, as
+// elemOptional says, and nil if they are slices.
+func (f implementation) decodeElems(dest reflect.Value, elems []string, nulls []bool, elemOptional bool, decode decoder, name Key) error {
+	vte := dest.Type().Elem()
+	dest.Set(reflect.MakeSlice(dest.Type(), len(elems), len(elems)))
+	for i, elem := range elems {
+		vi := dest.Index(i)
+		if vte.Kind() == reflect.Ptr {
+			vi.Set(reflect.New(vte.Elem()))
+			vi = vi.Elem()
+		}
+		if nulls[i] && (elemOptional || vi.Kind() == reflect.Slice) {
+			continue
+		}
+		if elemOptional {
+			vi.Addr().Interface().(optional).mark(append(Key{}, name...))
+			vi = optionalTarget(vi)
+		}
+		if err := decode(f, vi, elem, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get a field's value from the data source, falling back to its default if
+// the source has none, and determine whether the field has a value. If empty
+// is true, a value that is set but empty counts. Complain if a required field
+// has no value. If env is not empty, it must be name.AsEnv(). If the field's
+// own variable isn't set, try its aliases in turn. Either way, warn about
+// variables that are deprecated.
+func (f implementation) get(name Key, env string, tags tags, empty bool) (got string, set, fromDefault bool, err error) {
+	got, ok, err := f.lookup(name, env)
+	set = ok && (got != "" || empty)
+	present := ok
+	if err == nil && set && tags.deprecated {
+		message := name.AsEnv() + " is deprecated"
+		if tags.deprecation != "" {
+			message += "; " + tags.deprecation
+		}
+		err = f.deprecate(name, message)
+	}
+	for _, alias := range tags.aliases {
+		if err != nil || set {
+			break
+		}
+		got, ok, err = f.lookup(Key{alias}, alias)
+		set = ok && (got != "" || empty)
+		present = present || ok
+		if err == nil && set {
+			err = f.deprecate(name, fmt.Sprintf("%s is deprecated; use %s instead", alias, name.AsEnv()))
+		}
+	}
+	if err == nil && !set {
+		if tags.required {
+			err = &MissingValue{Name: name, Empty: present}
+		} else if tags.hasDefault {
+			got, fromDefault = tags.def, true
+			set = got != "" || empty
+		}
+	}
+	return
+}
+
+// Look a value up in the data source by its environment variable name, if
+// the source supports that and env isn't empty, and by its key otherwise.
+func (f implementation) lookup(name Key, env string) (string, bool, error) {
+	if getter, isEnv := f.source.(envLookuper); isEnv && env != "" {
+		return getter.lookupEnv(env)
+	}
+	return lookup(f.source, name)
+}
+
+// Split a JSON array into the string representations of its elements.
+// The empty string stands for an empty array.
+func splitJSON(got string) ([]string, error) {
+	elems, _, err := splitNullableJSON(got)
+	return elems, err
+}
+
+// Split a JSON array like splitJSON, and also determine which elements are
+// null.
+func splitNullableJSON(got string) ([]string, []bool, error) {
+	if got == "" {
+		return []string{}, []bool{}, nil
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal([]byte(got), &raw); err != nil {
+		return nil, nil, err
+	}
+	elems := make([]string, len(raw))
+	nulls := make([]bool, len(raw))
+	for i, elem := range raw {
+		elems[i] = jsonString(elem)
+		nulls[i] = string(elem) == "null"
+	}
+	return elems, nulls, nil
+}
+
+// Convert an element of a JSON array to the string representation expected by
+// assign(). Numbers are kept verbatim so that they don't lose precision by
+// passing through float64.
+func jsonString(raw json.RawMessage) string {
+	var str string
+	if json.Unmarshal(raw, &str) == nil {
+		return str
+	}
+	return string(raw)
+}
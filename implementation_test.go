@@ -1,6 +1,8 @@
 package flatpack
 
 import (
+	"encoding/json"
+	"io"
 	"reflect"
 
 	. "github.com/onsi/ginkgo"
@@ -29,6 +31,25 @@ type pointery struct {
 	Baz []*int
 }
 
+type nestedSlices struct {
+	Groups [][]string `flatpack:"oneof=a|b|c"`
+	IDs    [][]int64
+	Deep   [][]*[]Optional[uint8]
+}
+
+// For testing the json tag
+type jsonTagged struct {
+	Flags  map[string]interface{} `flatpack:"json"`
+	Limits struct {
+		CPU    float64 `json:"cpu"`
+		Memory string  `json:"memory"`
+	} `flatpack:"json"`
+	Routes  []struct{ Path string } `flatpack:"json,nonempty"`
+	Payload interface{}             `flatpack:"json"`
+	Extra   *[]int                  `flatpack:"json,default=[1]"`
+	Maybe   *Optional[[]string]     `flatpack:"json"`
+}
+
 type ignored struct {
 	Foo string
 	Bar map[string]int `flatpack:"ignore"`
@@ -38,8 +59,17 @@ type ignored struct {
 	quux *int `flatpack:"ignore"`
 }
 
+type skipped struct {
+	Foo    string
+	Ch     chan int
+	OnLoad func() error
+	Logger interface{ Print(...interface{}) }
+	err    error
+}
+
 // Test that we avoid a new panic introduced in go 1.5:
-//   reflect.Value.Interface: cannot return value obtained from unexported field or method
+//
+//	reflect.Value.Interface: cannot return value obtained from unexported field or method
 type badEmbedding struct {
 	embedded struct {
 		Value int
@@ -47,7 +77,8 @@ type badEmbedding struct {
 }
 
 // Test that we avoid a new panic introduced in go 1.5:
-//   reflect: reflect.Value.Set using value obtained using unexported field
+//
+//	reflect: reflect.Value.Set using value obtained using unexported field
 type badField struct {
 	value int
 }
@@ -60,19 +91,91 @@ type badType struct {
 	Foo map[string]bool
 }
 
+// For testing that the fields of embedded structs are promoted
+type CommonConfig struct {
+	LogLevel string `flatpack:"default=info"`
+	Name     string
+}
+
+type Tracing struct {
+	Endpoint string
+	Secret   string `flatpack:"secret"`
+}
+
+type unexportedEmbedded struct {
+	Team string
+}
+
+type embedding struct {
+	CommonConfig
+	*Tracing
+	unexportedEmbedded
+	Name string
+}
+
+type prefixedEmbedding struct {
+	CommonConfig `flatpack:"prefix"`
+}
+
+type ambiguousLeft struct{ Name, Left string }
+type ambiguousRight struct{ Name, Right string }
+
+type ambiguous struct {
+	ambiguousLeft
+	ambiguousRight
+}
+
+type badEmbeddedPointer struct {
+	*unexportedEmbedded
+}
+
+// For testing that set-but-empty values are values
+type emptied struct {
+	Prefix   string   `flatpack:"default=app"`
+	Hosts    []string `flatpack:"default=[\"a\"]"`
+	Port     int      `flatpack:"default=80"`
+	Name     *string
+	Tags     *[]string
+	Legacy   string `flatpack:"default=x,ignoreempty"`
+	Required string `flatpack:"required"`
+}
+
+type tagged struct {
+	Host    string `flatpack:"default=localhost"`
+	Port    int    `flatpack:"required"`
+	Ignored string `flatpack:"ignore"`
+	Nested  struct {
+		Foo string
+	} `flatpack:"required"`
+}
+
 var _ = Describe("implementation", func() {
 	Describe(".assign()", func() {
-		It("panics over unsupported types", func() {
-			it := implementation{stubEnvironment(map[string]string{})}
+		It("complains about unsupported types", func() {
+			it := implementation{source: stubEnvironment(map[string]string{})}
 			unsup := reflect.ValueOf(make(chan int))
-			Expect(func() {
-				it.assign(unsup, "", Key{})
-			}).To(Panic())
+			err := it.assign(unsup, "", Key{"Chan"})
+			Expect(err).To(MatchError(&BadType{Name: Key{"Chan"}, Kind: reflect.Chan, reason: "unsupported data type"}))
 
 			unsup2 := reflect.ValueOf(&badType{})
-			Expect(func() {
-				it.assign(unsup2, "", Key{})
-			}).To(Panic())
+			err = it.assign(unsup2, "", Key{"Ptr"})
+			Expect(err).To(MatchError(&BadType{Name: Key{"Ptr"}, Kind: reflect.Ptr, reason: "unsupported data type"}))
+		})
+
+		It("parses complex numbers and uintptrs", func() {
+			it := implementation{source: stubEnvironment(map[string]string{})}
+			var c64 complex64
+			Expect(it.assign(reflect.ValueOf(&c64).Elem(), "1+2i", Key{})).To(Succeed())
+			Expect(c64).To(Equal(complex64(1 + 2i)))
+			var c128 complex128
+			Expect(it.assign(reflect.ValueOf(&c128).Elem(), "(3.5-1e3i)", Key{})).To(Succeed())
+			Expect(c128).To(Equal(3.5 - 1e3i))
+			var ptr uintptr
+			Expect(it.assign(reflect.ValueOf(&ptr).Elem(), "0xff", Key{})).To(Succeed())
+			Expect(ptr).To(Equal(uintptr(255)))
+
+			err := it.assign(reflect.ValueOf(&c64).Elem(), "1+", Key{"C"})
+			Expect(err).To(BeAssignableToTypeOf(&BadValue{}))
 		})
 	})
 
@@ -86,7 +189,7 @@ var _ = Describe("implementation", func() {
 				"BAZ_BAZ":  "3.14159",
 				"BAZ_QUUX": "42",
 			}
-			it := implementation{stubEnvironment(env)}
+			it := implementation{source: stubEnvironment(env)}
 			err := it.Unmarshal(&fx)
 			Expect(err).To(Succeed())
 			Expect(fx.Foo).To(Equal("foo"))
@@ -101,19 +204,48 @@ var _ = Describe("implementation", func() {
 				"BAR":  `["foo", "bar"]`,
 				"QUUX": `[1,2,3]`,
 			}
-			it := implementation{stubEnvironment(env)}
+			it := implementation{source: stubEnvironment(env)}
 			err := it.Unmarshal(&fx)
 			Expect(err).To(Succeed())
 			Expect(fx.Bar).To(Equal([]string{"foo", "bar"}))
 			Expect(fx.Quux).To(Equal([]int{1, 2, 3}))
 		})
 
+		It("handles nested slices", func() {
+			fx := nestedSlices{}
+			env := map[string]string{
+				"GROUPS": `[["a", "b"], null, [], ["c"]]`,
+				"IDS":    `[[9007199254740993, -1], [0]]`,
+				"DEEP":   `[[[1, null], null]]`,
+			}
+			it := implementation{source: stubEnvironment(env)}
+			Expect(it.Unmarshal(&fx)).To(Succeed())
+			Expect(fx.Groups).To(Equal([][]string{{"a", "b"}, nil, {}, {"c"}}))
+			Expect(fx.IDs).To(Equal([][]int64{{9007199254740993, -1}, {0}}))
+			Expect(fx.Deep).To(HaveLen(1))
+			Expect(fx.Deep[0]).To(HaveLen(2))
+			Expect(*fx.Deep[0][0]).To(Equal([]Optional[uint8]{
+				{value: 1, set: true, key: Key{"Deep"}},
+				{},
+			}))
+			Expect(*fx.Deep[0][1]).To(BeNil())
+
+			env["GROUPS"] = `[["a"], ["d"]]`
+			env["IDS"] = `[[1], "2"]`
+			err := it.Unmarshal(&fx)
+			Expect(err).To(HaveOccurred())
+			Expect(err.(Errors)).To(ConsistOf(
+				&InvalidValue{Name: Key{"Groups"}, Rule: "oneof=a|b|c"},
+				BeAssignableToTypeOf(&BadValue{}),
+			))
+		})
+
 		It("allocates pointers when needed", func() {
 			fx := pointery{}
 			env := map[string]string{
 				"FOO_FOO": "foo foo",
 			}
-			it := implementation{stubEnvironment(env)}
+			it := implementation{source: stubEnvironment(env)}
 			err := it.Unmarshal(&fx)
 			Expect(err).To(Succeed())
 			Expect(fx.Bar).To(BeNil())
@@ -123,7 +255,7 @@ var _ = Describe("implementation", func() {
 				"BAR_FOO": "bar foo",
 				"BAZ":     `[1,2,3]`,
 			}
-			it = implementation{stubEnvironment(env)}
+			it = implementation{source: stubEnvironment(env)}
 			err = it.Unmarshal(&fx)
 			Expect(err).To(Succeed())
 			Expect(fx.Bar).NotTo(BeNil())
@@ -139,16 +271,258 @@ var _ = Describe("implementation", func() {
 				"BAZ":  "baz",
 				"QUUX": "42",
 			}
-			it := implementation{stubEnvironment(env)}
+			it := implementation{source: stubEnvironment(env)}
 			err := it.Unmarshal(&fx)
 			Expect(err).To(Succeed())
 			Expect(fx.Foo).To(Equal("foo"))
 		})
 
+		It("skips interfaces, channels and functions", func() {
+			fx := skipped{}
+			env := map[string]string{
+				"FOO":     "foo",
+				"CH":      "1",
+				"ON_LOAD": "x",
+				"LOGGER":  "y",
+				"ERR":     "z",
+			}
+			it := implementation{source: stubEnvironment(env)}
+			Expect(it.Unmarshal(&fx)).To(Succeed())
+			Expect(fx).To(Equal(skipped{Foo: "foo"}))
+
+			vars, err := Variables(&fx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vars).To(HaveLen(1))
+		})
+
+		Describe("the json tag", func() {
+			It("reads a whole field from one variable", func() {
+				fx := jsonTagged{}
+				env := map[string]string{
+					"FLAGS":   `{"beta": true, "rollout": 9007199254740993, "tiers": ["gold"]}`,
+					"LIMITS":  `{"cpu": 1.5, "memory": "512Mi"}`,
+					"ROUTES":  `[{"Path": "/"}, {"Path": "/api"}]`,
+					"PAYLOAD": `3`,
+				}
+				it := implementation{source: stubEnvironment(env)}
+				Expect(it.Unmarshal(&fx)).To(Succeed())
+				Expect(fx.Flags).To(Equal(map[string]interface{}{
+					"beta":    true,
+					"rollout": json.Number("9007199254740993"),
+					"tiers":   []interface{}{"gold"},
+				}))
+				Expect(fx.Limits.CPU).To(Equal(1.5))
+				Expect(fx.Limits.Memory).To(Equal("512Mi"))
+				Expect(fx.Routes).To(HaveLen(2))
+				Expect(fx.Routes[1].Path).To(Equal("/api"))
+				Expect(fx.Payload).To(Equal(json.Number("3")))
+				Expect(*fx.Extra).To(Equal([]int{1}))
+				Expect(fx.Maybe).To(BeNil())
+
+				env["MAYBE"] = `["a"]`
+				Expect(it.Unmarshal(&fx)).To(Succeed())
+				Expect(fx.Maybe.OrElse(nil)).To(Equal([]string{"a"}))
+			})
+
+			It("complains about malformed documents", func() {
+				env := map[string]string{
+					"FLAGS":  `{"beta": `,
+					"LIMITS": `{"cpu": "lots"}`,
+					"ROUTES": `[]`,
+					"EXTRA":  `[1] [2]`,
+				}
+				it := implementation{source: stubEnvironment(env)}
+				err := it.Unmarshal(&jsonTagged{})
+				Expect(err).To(HaveOccurred())
+				Expect(err.(Errors)).To(ConsistOf(
+					&BadValue{Name: Key{"Flags"}, Cause: io.ErrUnexpectedEOF},
+					BeAssignableToTypeOf(&BadValue{}),
+					&InvalidValue{Name: Key{"Routes"}, Rule: "nonempty"},
+					&BadValue{Name: Key{"Extra"}, Cause: errTrailingJSON},
+				))
+			})
+
+			It("round-trips through Marshal", func() {
+				fx := jsonTagged{Flags: map[string]interface{}{"beta": true}, Payload: []interface{}{"x"}}
+				fx.Limits.CPU = 2
+				env, err := Marshal(&fx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(env).To(Equal(map[string]string{
+					"FLAGS":   `{"beta":true}`,
+					"LIMITS":  `{"cpu":2,"memory":""}`,
+					"PAYLOAD": `["x"]`,
+				}))
+
+				schema, err := Schema(&fx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(schema.Properties["LIMITS"].Type).To(Equal("object"))
+				Expect(schema.Properties["EXTRA"].Default).To(Equal(json.RawMessage("[1]")))
+			})
+		})
+
+		It("applies defaults", func() {
+			fx := tagged{}
+			env := map[string]string{
+				"PORT":       "80",
+				"NESTED_FOO": "foo",
+				"IGNORED":    "ignored",
+			}
+			it := implementation{source: stubEnvironment(env)}
+			Expect(it.Unmarshal(&fx)).To(Succeed())
+			Expect(fx.Host).To(Equal("localhost"))
+			Expect(fx.Ignored).To(Equal(""))
+
+			env["HOST"] = "example.com"
+			Expect(it.Unmarshal(&fx)).To(Succeed())
+			Expect(fx.Host).To(Equal("example.com"))
+		})
+
+		Context("embedded structs", func() {
+			env := map[string]string{
+				"LOG_LEVEL": "debug",
+				"NAME":      "app",
+				"ENDPOINT":  "trace.example.com",
+				"TEAM":      "core",
+			}
+
+			It("promotes their fields", func() {
+				fx := embedding{}
+				it := implementation{source: stubEnvironment(env)}
+				Expect(it.Unmarshal(&fx)).To(Succeed())
+				Expect(fx.LogLevel).To(Equal("debug"))
+				Expect(fx.Name).To(Equal("app"))
+				Expect(fx.CommonConfig.Name).To(Equal(""))
+				Expect(fx.Tracing).NotTo(BeNil())
+				Expect(fx.Endpoint).To(Equal("trace.example.com"))
+				Expect(fx.Team).To(Equal("core"))
+			})
+
+			It("leaves embedded pointers nil when none of their fields are set", func() {
+				fx := embedding{Tracing: &Tracing{}}
+				it := implementation{source: stubEnvironment(map[string]string{"NAME": "app"})}
+				Expect(it.Unmarshal(&fx)).To(Succeed())
+				Expect(fx.Tracing).To(BeNil())
+				Expect(fx.LogLevel).To(Equal("info"))
+			})
+
+			It("keeps the type name as a prefix when asked to", func() {
+				fx := prefixedEmbedding{}
+				it := implementation{source: stubEnvironment(map[string]string{
+					"COMMON_CONFIG_LOG_LEVEL": "warn",
+					"LOG_LEVEL":               "debug",
+				})}
+				Expect(it.Unmarshal(&fx)).To(Succeed())
+				Expect(fx.LogLevel).To(Equal("warn"))
+			})
+
+			It("drops fields whose names are ambiguous", func() {
+				fx := ambiguous{}
+				it := implementation{source: stubEnvironment(map[string]string{
+					"NAME":  "app",
+					"LEFT":  "left",
+					"RIGHT": "right",
+				})}
+				Expect(it.Unmarshal(&fx)).To(Succeed())
+				Expect(fx.ambiguousLeft).To(Equal(ambiguousLeft{Left: "left"}))
+				Expect(fx.ambiguousRight).To(Equal(ambiguousRight{Right: "right"}))
+			})
+
+			It("agrees with Marshal", func() {
+				fx := embedding{}
+				Expect(implementation{source: stubEnvironment(env)}.Unmarshal(&fx)).To(Succeed())
+				got, err := Marshal(&fx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(got).To(Equal(map[string]string{
+					"LOG_LEVEL": "debug",
+					"NAME":      "app",
+					"ENDPOINT":  "trace.example.com",
+					"TEAM":      "core",
+					"SECRET":    "",
+				}))
+
+				fx.Tracing = nil
+				got, err = Marshal(&fx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(got).NotTo(HaveKey("ENDPOINT"))
+			})
+
+			It("are redacted without touching the original", func() {
+				fx := embedding{Tracing: &Tracing{Secret: "hush"}}
+				redacted := Redacted(&fx).(*embedding)
+				Expect(redacted.Secret).To(Equal(Mask))
+				Expect(fx.Secret).To(Equal("hush"))
+				Expect(Redacted(&embedding{}).(*embedding).Tracing).To(BeNil())
+			})
+
+			It("can't be unexported pointers", func() {
+				fx := badEmbeddedPointer{}
+				err := implementation{source: stubEnvironment(env)}.Unmarshal(&fx)
+				Expect(err).To(MatchError(&NoReflection{Name: Key{"unexportedEmbedded"}}))
+			})
+		})
+
+		Context("empty values", func() {
+			env := map[string]string{
+				"PREFIX":   "",
+				"HOSTS":    "",
+				"PORT":     "",
+				"NAME":     "",
+				"TAGS":     "[]",
+				"LEGACY":   "",
+				"REQUIRED": "",
+			}
+
+			It("set strings and slices", func() {
+				fx := emptied{}
+				Expect(implementation{source: stubEnvironment(env)}.Unmarshal(&fx)).To(Succeed())
+				Expect(fx.Prefix).To(Equal(""))
+				Expect(fx.Hosts).To(Equal([]string{}))
+				Expect(fx.Name).NotTo(BeNil())
+				Expect(*fx.Name).To(Equal(""))
+				Expect(fx.Tags).NotTo(BeNil())
+				Expect(*fx.Tags).To(Equal([]string{}))
+			})
+
+			It("don't count for other types, or when the tag says so", func() {
+				fx := emptied{}
+				Expect(implementation{source: stubEnvironment(env)}.Unmarshal(&fx)).To(Succeed())
+				Expect(fx.Port).To(Equal(80))
+				Expect(fx.Legacy).To(Equal("x"))
+
+				err := implementation{source: stubEnvironment(map[string]string{"PORT": ""})}.Unmarshal(&tagged{})
+				Expect(err).To(MatchError(ContainSubstring("field is required but empty (name=Port)")))
+			})
+
+			It("don't count if the source can't tell them from unset ones", func() {
+				fx := emptied{}
+				source := &countingGetter{source: stubEnvironment(env), calls: map[string]int{}}
+				err := implementation{source: source}.Unmarshal(&fx)
+				Expect(err).To(MatchError(&MissingValue{Name: Key{"Required"}}))
+				Expect(fx.Prefix).To(Equal("app"))
+				Expect(fx.Hosts).To(Equal([]string{"a"}))
+				Expect(fx.Name).To(BeNil())
+			})
+		})
+
 		Context("error reporting", func() {
+			It("complains about missing required values", func() {
+				fx := tagged{}
+				env := map[string]string{"NESTED_FOO": "foo"}
+				it := implementation{source: stubEnvironment(env)}
+				err := it.Unmarshal(&fx)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(MatchRegexp(`missing value.*name=Port`))
+
+				env = map[string]string{"PORT": "80"}
+				it = implementation{source: stubEnvironment(env)}
+				err = it.Unmarshal(&fx)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(MatchRegexp(`missing value.*name=Nested`))
+			})
+
 			It("complains about struct values", func() {
 				fx := simple{}
-				it := implementation{stubEnvironment(map[string]string{})}
+				it := implementation{source: stubEnvironment(map[string]string{})}
 
 				err := it.Unmarshal(fx)
 				Expect(err).To(HaveOccurred())
@@ -167,14 +541,14 @@ var _ = Describe("implementation", func() {
 					"BAR":     `["not-a-valid-json-array`,
 					"BAZ_FOO": "baz foo",
 				}
-				it := implementation{stubEnvironment(env)}
+				it := implementation{source: stubEnvironment(env)}
 				err := it.Unmarshal(&fx)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(MatchRegexp("unexpected end of JSON input"))
 			})
 
 			It("complains about reflection without panicking", func() {
-				it := implementation{stubEnvironment(map[string]string{
+				it := implementation{source: stubEnvironment(map[string]string{
 					"EMBEDDED_VALUE": "42",
 					"VALUE":          "43",
 					"POINTER_VALUE":  "44",
@@ -201,7 +575,7 @@ var _ = Describe("implementation", func() {
 				env := map[string]string{
 					"BAZ_BAR": "not-a-number",
 				}
-				it := implementation{stubEnvironment(env)}
+				it := implementation{source: stubEnvironment(env)}
 				s := simple{}
 
 				err := it.Unmarshal(&s)
@@ -211,7 +585,7 @@ var _ = Describe("implementation", func() {
 				env = map[string]string{
 					"BAZ_QUUX": "not-a-number",
 				}
-				it = implementation{stubEnvironment(env)}
+				it = implementation{source: stubEnvironment(env)}
 
 				err = it.Unmarshal(&s)
 				Expect(err).To(HaveOccurred())
@@ -220,7 +594,7 @@ var _ = Describe("implementation", func() {
 
 			It("complains about unsupported types", func() {
 				env := map[string]string{}
-				it := implementation{stubEnvironment(env)}
+				it := implementation{source: stubEnvironment(env)}
 				s := badType{}
 				err := it.Unmarshal(&s)
 				Expect(err).To(HaveOccurred())
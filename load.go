@@ -0,0 +1,29 @@
+package flatpack
+
+// Load reads configuration data into a new value of type T and returns it,
+// applying defaults and validation exactly like Unmarshal:
+//
+//	config, err := flatpack.Load[Config]()
+//
+// By default, Load reads from the package's DataSource; use the WithSource
+// option to read from elsewhere.
+//
+// T must be a struct type. Go's type parameters can't express that
+// constraint, so anything else is reported as a BadType, just as if a
+// pointer to it had been passed to Unmarshal.
+func Load[T any](opts ...Option) (T, error) {
+	var config T
+	err := New(DataSource, opts...).Unmarshal(&config)
+	return config, err
+}
+
+// MustLoad is like Load, but panics if the configuration can't be loaded. It
+// is meant for programs that can't do anything useful without their
+// configuration, e.g. in the initialization of a package-level variable.
+func MustLoad[T any](opts ...Option) T {
+	config, err := Load[T](opts...)
+	if err != nil {
+		panic(err)
+	}
+	return config
+}
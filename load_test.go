@@ -0,0 +1,63 @@
+package flatpack
+
+import (
+	"errors"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Load", func() {
+	env := map[string]string{"HOST": "example.com", "PORT": "8080", "NESTED_FOO": "foo"}
+
+	It("returns a ready-to-use config", func() {
+		config, err := Load[tagged](WithSource(stubEnvironment(env)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Host).To(Equal("example.com"))
+		Expect(config.Port).To(Equal(8080))
+		Expect(config.Nested.Foo).To(Equal("foo"))
+	})
+
+	It("applies defaults and validation", func() {
+		config, err := Load[tagged](WithSource(stubEnvironment(map[string]string{"PORT": "1", "NESTED_FOO": "foo"})))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Host).To(Equal("localhost"))
+
+		_, err = Load[tagged](WithSource(stubEnvironment(map[string]string{})))
+		Expect(err).To(HaveOccurred())
+		Expect(errors.As(err, new(*MissingValue))).To(BeTrue())
+
+		_, err = Load[constrained](WithSource(stubEnvironment(map[string]string{"PORT": "0"})))
+		Expect(err).To(MatchError(&InvalidValue{Name: Key{"Port"}, Rule: "min=1"}))
+	})
+
+	It("combines options in any order", func() {
+		env := map[string]string{"FOO": "base", "STAGING__FOO": "staging"}
+		config, err := Load[simple](WithProfile("staging"), WithSource(stubEnvironment(env)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Foo).To(Equal("staging"))
+	})
+
+	It("uses the package's DataSource", func() {
+		DataSource = stubEnvironment(env)
+		defer func() { DataSource = processEnvironment{os.LookupEnv} }()
+
+		config := MustLoad[tagged]()
+		Expect(config.Port).To(Equal(8080))
+	})
+
+	It("rejects types other than structs", func() {
+		_, err := Load[int](WithSource(stubEnvironment(env)))
+		Expect(err).To(BeAssignableToTypeOf(&BadType{}))
+
+		_, err = Load[*tagged](WithSource(stubEnvironment(env)))
+		Expect(err).To(BeAssignableToTypeOf(&BadType{}))
+	})
+
+	It("panics in MustLoad", func() {
+		Expect(func() {
+			MustLoad[tagged](WithSource(stubEnvironment(map[string]string{})))
+		}).To(PanicWith(BeAssignableToTypeOf(Errors{})))
+	})
+})
@@ -0,0 +1,81 @@
+package flatpack
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+)
+
+// WithLogger makes an Unmarshaller describe its work to logger, to help with
+// debugging startup problems. Every key that is looked up is logged at debug
+// level, with its variable name, where its value came from, whether it was
+// found and the type that it is read into; values of secret fields are
+// masked. A summary of each Unmarshal is logged at info level.
+//
+// Unless there is a deprecation handler, deprecations are logged too, as
+// warnings.
+//
+// Generated UnmarshalFlatpack methods don't log, so Unmarshal reflects
+// instead of calling them.
+func WithLogger(logger *slog.Logger) Option {
+	return func(f *implementation) {
+		f.logger = logger
+	}
+}
+
+// Log a key that has just been looked up, if anyone is interested.
+func (f implementation) trace(name Key, tags tags, t reflect.Type, raw string, set, fromDefault bool) {
+	if f.logger == nil || !f.logger.Enabled(f.contextOrBackground(), slog.LevelDebug) {
+		return
+	}
+	source := "default"
+	if !fromDefault {
+		source = describe(f.source, name)
+	}
+	attrs := []slog.Attr{
+		slog.String("key", name.String()),
+		slog.String("env", name.AsEnv()),
+		slog.String("source", source),
+		slog.Bool("found", set && !fromDefault),
+		slog.String("type", t.String()),
+	}
+	if set {
+		if tags.secret {
+			raw = Mask
+		}
+		attrs = append(attrs, slog.String("value", raw))
+	}
+	f.logger.LogAttrs(f.contextOrBackground(), slog.LevelDebug, "flatpack: looked up key", attrs...)
+}
+
+// Log the outcome of unmarshalling into a struct: how many fields were set,
+// and how many errors there were.
+func (f implementation) summarize(t reflect.Type, count int, err error) {
+	if f.logger == nil {
+		return
+	}
+	errs := 0
+	if list, ok := err.(Errors); ok {
+		errs = len(list)
+	} else if err != nil {
+		errs = 1
+	}
+	f.logger.LogAttrs(f.contextOrBackground(), slog.LevelInfo, "flatpack: unmarshalled configuration",
+		slog.String("type", t.String()),
+		slog.Int("count", count),
+		slog.Int("errors", errs),
+	)
+}
+
+// Log a deprecation as a warning.
+func logDeprecation(logger *slog.Logger, name Key, message string) {
+	logger.Warn("flatpack: "+message, "key", name.String())
+}
+
+// Return the context passed to UnmarshalContext, if any.
+func (f implementation) contextOrBackground() context.Context {
+	if f.ctx == nil {
+		return context.Background()
+	}
+	return f.ctx
+}
@@ -0,0 +1,73 @@
+package flatpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type logged struct {
+	Host     string `flatpack:"default=localhost"`
+	Port     int
+	Password Secret
+	Tags     []string
+	Nested   struct {
+		Debug bool `flatpack:"deprecated=use LOG_LEVEL instead"`
+	}
+}
+
+// Create a logger that writes JSON records without times to buf.
+func jsonLogger(buf *bytes.Buffer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+}
+
+// Parse the records written by jsonLogger.
+func records(buf *bytes.Buffer) []map[string]interface{} {
+	var result []map[string]interface{}
+	decoder := json.NewDecoder(buf)
+	for decoder.More() {
+		record := map[string]interface{}{}
+		Expect(decoder.Decode(&record)).To(Succeed())
+		result = append(result, record)
+	}
+	return result
+}
+
+var _ = Describe("WithLogger", func() {
+	env := map[string]string{"PORT": "8080", "PASSWORD": "hunter2", "NESTED_DEBUG": "true"}
+
+	It("logs every key that is looked up", func() {
+		buf := bytes.Buffer{}
+		it := New(stubEnvironment(env), WithLogger(jsonLogger(&buf, slog.LevelDebug)))
+		Expect(it.Unmarshal(&logged{})).To(Succeed())
+		Expect(records(&buf)).To(Equal([]map[string]interface{}{
+			{"level": "DEBUG", "msg": "flatpack: looked up key", "key": "Host", "env": "HOST", "source": "default", "found": false, "type": "string", "value": "localhost"},
+			{"level": "DEBUG", "msg": "flatpack: looked up key", "key": "Port", "env": "PORT", "source": "environment", "found": true, "type": "int", "value": "8080"},
+			{"level": "DEBUG", "msg": "flatpack: looked up key", "key": "Password", "env": "PASSWORD", "source": "environment", "found": true, "type": "flatpack.Secret", "value": Mask},
+			{"level": "DEBUG", "msg": "flatpack: looked up key", "key": "Tags", "env": "TAGS", "source": "environment", "found": false, "type": "[]string"},
+			{"level": "WARN", "msg": "flatpack: NESTED_DEBUG is deprecated; use LOG_LEVEL instead", "key": "Nested.Debug"},
+			{"level": "DEBUG", "msg": "flatpack: looked up key", "key": "Nested.Debug", "env": "NESTED_DEBUG", "source": "environment", "found": true, "type": "bool", "value": "true"},
+			{"level": "INFO", "msg": "flatpack: unmarshalled configuration", "type": "flatpack.logged", "count": float64(4), "errors": float64(0)},
+		}))
+	})
+
+	It("summarizes at info level", func() {
+		buf := bytes.Buffer{}
+		it := New(stubEnvironment(map[string]string{"PORT": "x", "PASSWORD": "["}), WithLogger(jsonLogger(&buf, slog.LevelInfo)))
+		Expect(it.Unmarshal(&logged{})).NotTo(Succeed())
+		Expect(records(&buf)).To(Equal([]map[string]interface{}{
+			{"level": "INFO", "msg": "flatpack: unmarshalled configuration", "type": "flatpack.logged", "count": float64(3), "errors": float64(1)},
+		}))
+	})
+})
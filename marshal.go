@@ -0,0 +1,240 @@
+package flatpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// Marshal converts a configuration struct into environment variables, i.e.
+// the inverse of Unmarshal. The keys of the returned map are derived from
+// field names in the same way as Unmarshal derives them, and the values are
+// formatted so that Unmarshal parses them back to the same field values.
+//
+// Fields that Unmarshal would not populate are omitted: nil slices, nil
+// pointers and empty strings in fields with the ignoreempty tag. Other empty
+// strings are included, since Unmarshal reads a variable that is set but
+// empty as a value, rather than using the field's default. Note that a
+// non-nil pointer to a struct whose fields are all omitted will come back
+// from Unmarshal as nil.
+func Marshal(src interface{}) (map[string]string, error) {
+	pairs, err := marshal(src)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		result[pair.name] = pair.value
+	}
+	return result, nil
+}
+
+// MarshalDotenv writes a configuration struct to w in the format of a .env
+// file, with one NAME=value line per field in field order. Values are quoted
+// if they contain anything but letters, digits and a few safe punctuation
+// characters.
+func MarshalDotenv(w io.Writer, src interface{}) error {
+	pairs, err := marshal(src)
+	if err != nil {
+		return err
+	}
+	buf := bytes.Buffer{}
+	for _, pair := range pairs {
+		fmt.Fprintf(&buf, "%s=%s\n", pair.name, quoteDotenv(pair.value))
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// An environment variable name and value, produced by marshalling.
+type envPair struct {
+	name, value string
+}
+
+// Marshal a struct, or pointer to struct, into an ordered list of pairs.
+func marshal(src interface{}) ([]envPair, error) {
+	v, err := structValue(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var pairs []envPair
+	err = walk(v, false, func(name Key, field *reflect.StructField, value reflect.Value) error {
+		tags := parseTags(field)
+		formatted, err := marshalField(name, tags, value)
+		if err == nil && (formatted != "" || value.Kind() == reflect.String && acceptsEmpty(value.Kind(), tags)) {
+			pairs = append(pairs, envPair{name.AsEnv(), formatted})
+		}
+		return err
+	})
+	return pairs, err
+}
+
+// Return the struct that src is or points to.
+func structValue(src interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(src)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return v, &BadValue{Name: Key{}, expected: "non-nil pointer to struct"}
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return v, &BadType{Name: Key{}, Kind: v.Kind(), reason: "expected struct"}
+	}
+	return v, nil
+}
+
+// Format the value of a scalar or slice field, or of any field with the json
+// tag. This is the inverse of implementation.read; it returns the empty
+// string for values that read would not populate.
+func marshalField(name Key, tags tags, value reflect.Value) (string, error) {
+	if tags.json {
+		switch value.Kind() {
+		case reflect.Interface, reflect.Map, reflect.Slice:
+			if value.IsNil() {
+				return "", nil
+			}
+		}
+		data, err := json.Marshal(value.Interface())
+		if err != nil {
+			return "", &BadValue{Name: name, Cause: err}
+		}
+		return string(data), nil
+	}
+	if value.Kind() != reflect.Slice {
+		return format(value), nil
+	}
+	if value.IsNil() {
+		return "", nil
+	}
+
+	elems, err := formatElems(name, value)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(elems)
+	if err != nil {
+		return "", &BadValue{Name: name, Cause: err}
+	}
+	return string(data), nil
+}
+
+// Convert the elements of a slice to values that encoding/json will
+// represent as a JSON array that implementation.read understands. Nested
+// slices become nested arrays, and nil ones become null.
+func formatElems(name Key, value reflect.Value) ([]interface{}, error) {
+	elems := make([]interface{}, value.Len())
+	for i := range elems {
+		vi := value.Index(i)
+		if vi.Kind() == reflect.Ptr {
+			if vi.IsNil() {
+				return nil, &BadValue{Name: name, expected: "slice without nil elements"}
+			}
+			vi = vi.Elem()
+		}
+		if optionalElem(vi.Type()) != nil {
+			var set bool
+			if vi, set = optionalValue(vi); !set {
+				// elems[i] is nil, which becomes JSON null
+				continue
+			}
+		}
+		if vi.Kind() == reflect.Slice {
+			if !vi.IsNil() {
+				nested, err := formatElems(name, vi)
+				if err != nil {
+					return nil, err
+				}
+				elems[i] = nested
+			}
+			continue
+		}
+		elem, err := formatJSON(vi)
+		if err != nil {
+			return nil, &BadType{Name: name, Kind: vi.Kind(), reason: "unsupported slice element type"}
+		}
+		elems[i] = elem
+	}
+	return elems, nil
+}
+
+// Format a scalar Value as a string that implementation.assign will parse
+// back to the same value.
+func format(value reflect.Value) string {
+	switch value.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(value.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'g', -1, int(value.Type().Size()*8))
+	case reflect.Complex64, reflect.Complex128:
+		return strconv.FormatComplex(value.Complex(), 'g', -1, int(value.Type().Size()*8))
+	case reflect.String:
+		return value.String()
+	}
+	return ""
+}
+
+// Convert a scalar Value to something that encoding/json will represent in
+// a way that implementation.read understands. Numbers are passed as
+// json.Number so that they are never converted to float64 along the way,
+// except for NaN and infinities, which JSON numbers can't represent; they
+// become strings, which read accepts as well.
+func formatJSON(value reflect.Value) (interface{}, error) {
+	switch value.Kind() {
+	case reflect.Bool:
+		return value.Bool(), nil
+	case reflect.Float32, reflect.Float64:
+		if f := value.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			return format(value), nil
+		}
+		return json.Number(format(value)), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return json.Number(format(value)), nil
+	case reflect.Complex64, reflect.Complex128, reflect.String:
+		return format(value), nil
+	}
+	return nil, fmt.Errorf("unsupported kind %s", value.Kind())
+}
+
+// Quote a value for inclusion in a .env file, if necessary.
+func quoteDotenv(value string) string {
+	safe := value != ""
+	for _, char := range value {
+		if !(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' ||
+			char >= '0' && char <= '9' || bytes.ContainsRune([]byte("_-.,:/@+"), char)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return value
+	}
+
+	quoted := bytes.Buffer{}
+	quoted.WriteRune('"')
+	for _, char := range value {
+		switch char {
+		case '"', '\\', '$', '`':
+			quoted.WriteRune('\\')
+			quoted.WriteRune(char)
+		case '\n':
+			quoted.WriteString(`\n`)
+		default:
+			quoted.WriteRune(char)
+		}
+	}
+	quoted.WriteRune('"')
+	return quoted.String()
+}
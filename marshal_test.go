@@ -0,0 +1,154 @@
+package flatpack
+
+import (
+	"bytes"
+	"math"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type marshalled struct {
+	Name    string
+	Enabled bool
+	Port    uint16
+	Offset  int64
+	Ratio   float32
+	Scale   float64
+	Hosts   []string
+	IDs     []int64
+	Weights []*float64
+	Empty   []string
+	Nested  struct {
+		Greeting string
+	}
+	Missing *struct {
+		Value int
+	}
+	Present *struct {
+		Value int
+	}
+	Skipped chan int `flatpack:"ignore"`
+}
+
+var _ = Describe("Marshal()", func() {
+	weight := 0.1
+	src := marshalled{
+		Name:    `Quoted "name" with $dollars`,
+		Enabled: true,
+		Port:    65535,
+		Offset:  math.MinInt64,
+		Ratio:   16.84,
+		Scale:   math.Pi,
+		Hosts:   []string{"a", "b c"},
+		IDs:     []int64{math.MaxInt64, 1},
+		Weights: []*float64{&weight},
+		Empty:   []string{},
+	}
+	src.Nested.Greeting = "hello"
+	src.Present = &struct{ Value int }{42}
+
+	It("uses the same names as Unmarshal", func() {
+		env, err := Marshal(&src)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(HaveKeyWithValue("NAME", src.Name))
+		Expect(env).To(HaveKeyWithValue("NESTED_GREETING", "hello"))
+		Expect(env).To(HaveKeyWithValue("PRESENT_VALUE", "42"))
+		Expect(env).To(HaveKeyWithValue("IDS", "[9223372036854775807,1]"))
+		Expect(env).To(HaveKeyWithValue("EMPTY", "[]"))
+		Expect(env).NotTo(HaveKey("MISSING_VALUE"))
+		Expect(env).NotTo(HaveKey("SKIPPED"))
+	})
+
+	It("round-trips through Unmarshal", func() {
+		env, err := Marshal(src)
+		Expect(err).NotTo(HaveOccurred())
+		got := marshalled{}
+		Expect(implementation{source: stubEnvironment(env)}.Unmarshal(&got)).To(Succeed())
+		Expect(got).To(Equal(src))
+	})
+
+	It("writes empty strings that override defaults", func() {
+		type defaulted struct {
+			Prefix  string  `flatpack:"default=x"`
+			Suffix  *string `flatpack:"default=y"`
+			Ignored string  `flatpack:"default=z,ignoreempty"`
+		}
+		empty := ""
+		src := defaulted{Suffix: &empty}
+		env, err := Marshal(src)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(Equal(map[string]string{"PREFIX": "", "SUFFIX": ""}))
+
+		got := defaulted{}
+		Expect(implementation{source: stubEnvironment(env)}.Unmarshal(&got)).To(Succeed())
+		Expect(got).To(Equal(defaulted{Suffix: &empty, Ignored: "z"}))
+	})
+
+	It("round-trips NaN and infinities in slices", func() {
+		type floats struct {
+			Values [][]float64
+		}
+		env, err := Marshal(floats{[][]float64{{math.NaN(), math.Inf(1)}, {math.Inf(-1)}}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(Equal(map[string]string{"VALUES": `[["NaN","+Inf"],["-Inf"]]`}))
+
+		got := floats{}
+		Expect(implementation{source: stubEnvironment(env)}.Unmarshal(&got)).To(Succeed())
+		Expect(math.IsNaN(got.Values[0][0])).To(BeTrue())
+		Expect(got.Values[0][1]).To(Equal(math.Inf(1)))
+		Expect(got.Values[1]).To(Equal([]float64{math.Inf(-1)}))
+	})
+
+	It("formats nested slices as nested arrays", func() {
+		src := nestedSlices{Groups: [][]string{{"a"}, nil, {}}, IDs: [][]int64{{math.MaxInt64}}}
+		env, err := Marshal(&src)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(Equal(map[string]string{
+			"GROUPS": `[["a"],null,[]]`,
+			"IDS":    `[[9223372036854775807]]`,
+		}))
+		got := nestedSlices{}
+		Expect(implementation{source: stubEnvironment(env)}.Unmarshal(&got)).To(Succeed())
+		Expect(got).To(Equal(src))
+	})
+
+	It("complains about unsupported types", func() {
+		_, err := Marshal(&badType{Foo: map[string]bool{}})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(MatchRegexp("invalid type"))
+
+		_, err = Marshal(&badField{})
+		Expect(err.Error()).To(MatchRegexp("reflection error"))
+
+		_, err = Marshal(42)
+		Expect(err.Error()).To(MatchRegexp("expected struct"))
+	})
+
+	It("complains about nil slice elements", func() {
+		_, err := Marshal(&pointery{Baz: []*int{nil}})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(MatchRegexp("invalid value"))
+	})
+
+	Describe("MarshalDotenv()", func() {
+		It("writes quoted lines in field order", func() {
+			buf := bytes.Buffer{}
+			Expect(MarshalDotenv(&buf, &simple{Foo: "foo", Bar: []string{"x"}})).To(Succeed())
+			Expect(buf.String()).To(Equal(
+				"FOO=foo\n" +
+					"BAR=\"[\\\"x\\\"]\"\n" +
+					"BAZ_FOO=\"\"\n" +
+					"BAZ_BAR=0\n" +
+					"BAZ_BAZ=0\n" +
+					"BAZ_QUUX=0\n"))
+		})
+
+		It("escapes special characters", func() {
+			Expect(quoteDotenv("plain-value_1.2:3/4@5")).To(Equal("plain-value_1.2:3/4@5"))
+			Expect(quoteDotenv("")).To(Equal(`""`))
+			Expect(quoteDotenv("a b")).To(Equal(`"a b"`))
+			Expect(quoteDotenv("$HOME \"x\"\n")).To(Equal(`"\$HOME \"x\"\n"`))
+		})
+	})
+})
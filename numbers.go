@@ -0,0 +1,122 @@
+package flatpack
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Parse an integer like strconv.ParseInt with base 0, i.e. with Go's base
+// prefixes (0x, 0o, 0b) and underscores, except that a leading zero doesn't
+// make a number octal: 0755 is 755, but 0o755 is 493.
+func parseInt(s string, bitSize int) (int64, error) {
+	n, err := strconv.ParseInt(decimal(s), 0, bitSize)
+	return n, numError(err, s)
+}
+
+// Parse an unsigned integer in the same way as parseInt.
+func parseUint(s string, bitSize int) (uint64, error) {
+	n, err := strconv.ParseUint(decimal(s), 0, bitSize)
+	return n, numError(err, s)
+}
+
+// Strip the leading zeros of a number without a base prefix, so that
+// strconv doesn't take it for an octal number.
+func decimal(s string) string {
+	sign, digits := "", s
+	if strings.HasPrefix(digits, "+") || strings.HasPrefix(digits, "-") {
+		sign, digits = digits[:1], digits[1:]
+	}
+	if len(digits) < 2 || digits[0] != '0' || digits[1] < '0' || digits[1] > '9' {
+		return s
+	}
+	digits = strings.TrimLeft(digits, "0")
+	if digits == "" || digits[0] == '_' {
+		digits = "0" + digits
+	}
+	return sign + digits
+}
+
+// Units that may follow a number of bytes. Longer names come first, so that
+// they are matched before their suffixes.
+var byteUnits = []struct {
+	name string
+	size uint64
+}{
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"KB", 1e3},
+	{"MB", 1e6},
+	{"GB", 1e9},
+	{"B", 1},
+}
+
+var errFractionalBytes = errors.New("not a whole number of bytes")
+
+// Parse a number of bytes with an optional unit, e.g. 512MiB or 1.5GB, that
+// must fit in bitSize bits. Units are case-insensitive; KB, MB and GB are
+// powers of 1000, and KiB, MiB and GiB are powers of 1024. A suffix is only
+// taken for a unit if the whole string isn't a number, so 0x1B is 27 bytes.
+func parseBytes(s string, bitSize int) (uint64, error) {
+	number := strings.TrimSpace(s)
+	n, err := scaleBytes(number, 1, bitSize)
+	if err == strconv.ErrSyntax {
+		for _, u := range byteUnits {
+			if len(number) > len(u.name) && strings.EqualFold(number[len(number)-len(u.name):], u.name) {
+				n, err = scaleBytes(strings.TrimSpace(number[:len(number)-len(u.name)]), u.size, bitSize)
+				break
+			}
+		}
+	}
+	if err != nil {
+		return 0, &strconv.NumError{Func: "ParseBytes", Num: s, Err: err}
+	}
+	return n, nil
+}
+
+// Multiply a number without a unit by the size of a unit, on behalf of
+// parseBytes.
+func scaleBytes(number string, unit uint64, bitSize int) (uint64, error) {
+	max := uint64(math.MaxUint64) >> (64 - bitSize)
+	if n, err := parseUint(number, 64); err == nil {
+		if n > max/unit {
+			return 0, strconv.ErrRange
+		}
+		return n * unit, nil
+	}
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil || f < 0 {
+		return 0, strconv.ErrSyntax
+	}
+	total := f * float64(unit)
+	if total != math.Trunc(total) {
+		return 0, errFractionalBytes
+	} else if total >= math.Ldexp(1, bitSize) {
+		return 0, strconv.ErrRange
+	}
+	return uint64(total), nil
+}
+
+// Parse a percentage, e.g. 12.5%, as a fraction. A number without a percent
+// sign is taken to be a fraction already.
+func parsePercent(s string, bitSize int) (float64, error) {
+	number, divisor := strings.TrimSpace(s), 1.0
+	if strings.HasSuffix(number, "%") {
+		number, divisor = strings.TrimSpace(strings.TrimSuffix(number, "%")), 100
+	}
+	f, err := strconv.ParseFloat(number, bitSize)
+	if err != nil {
+		return 0, &strconv.NumError{Func: "ParsePercent", Num: s, Err: err.(*strconv.NumError).Err}
+	}
+	return f / divisor, nil
+}
+
+// Make a strconv error mention the string that was originally parsed.
+func numError(err error, s string) error {
+	if e, ok := err.(*strconv.NumError); ok {
+		e.Num = s
+	}
+	return err
+}
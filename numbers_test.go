@@ -0,0 +1,133 @@
+package flatpack
+
+import (
+	"strconv"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type sized struct {
+	Count   int
+	Mode    uint32
+	Memory  int64     `flatpack:"bytes"`
+	Buffer  uint16    `flatpack:"bytes"`
+	Limits  []int     `flatpack:"bytes"`
+	Ratio   float64   `flatpack:"percent"`
+	Weights []float32 `flatpack:"percent"`
+}
+
+var _ = Describe("numbers", func() {
+	ints := map[string]int64{
+		"42":        42,
+		"-42":       -42,
+		"0x1F":      31,
+		"0o755":     493,
+		"0b101":     5,
+		"1_000_000": 1000000,
+		"0755":      755,
+		"-007":      -7,
+		"0":         0,
+		"00":        0,
+	}
+	for s, expected := range ints {
+		s, expected := s, expected
+		It("parses the integer "+s, func() {
+			Expect(parseInt(s, 64)).To(Equal(expected))
+		})
+	}
+
+	It("mentions the original string in errors", func() {
+		_, err := parseInt("0012x", 64)
+		Expect(err).To(MatchError(`strconv.ParseInt: parsing "0012x": invalid syntax`))
+		_, err = parseUint("0x1FF", 8)
+		Expect(err).To(MatchError(`strconv.ParseUint: parsing "0x1FF": value out of range`))
+	})
+
+	sizes := map[string]uint64{
+		"512":     512,
+		"512B":    512,
+		"2KB":     2000,
+		"2 KiB":   2048,
+		"512MiB":  512 << 20,
+		"1.5GB":   1500000000,
+		"1.5gib":  3 << 29,
+		"0x10KiB": 16 << 10,
+		"0x1B":    0x1B,
+		"0xB":     0xB,
+		"0x1 B":   1,
+		"0b1B":    1,
+	}
+	for s, expected := range sizes {
+		s, expected := s, expected
+		It("parses the size "+s, func() {
+			Expect(parseBytes(s, 64)).To(Equal(expected))
+		})
+	}
+
+	It("rejects bad sizes", func() {
+		for s, cause := range map[string]error{
+			"1.5B":  errFractionalBytes,
+			"-1KB":  strconv.ErrSyntax,
+			"MiB":   strconv.ErrSyntax,
+			"64KiB": strconv.ErrRange,
+			"1e9GB": strconv.ErrRange,
+		} {
+			_, err := parseBytes(s, 16)
+			Expect(err).To(Equal(&strconv.NumError{Func: "ParseBytes", Num: s, Err: cause}), s)
+		}
+	})
+
+	It("parses percentages", func() {
+		Expect(parsePercent("50%", 64)).To(Equal(0.5))
+		Expect(parsePercent(" 12.5 % ", 64)).To(Equal(0.125))
+		Expect(parsePercent("0.25", 64)).To(Equal(0.25))
+		_, err := parsePercent("half%", 64)
+		Expect(err).To(MatchError(`strconv.ParsePercent: parsing "half%": invalid syntax`))
+	})
+
+	It("are read by Unmarshal", func() {
+		fx := sized{}
+		it := implementation{source: stubEnvironment(map[string]string{
+			"COUNT":   "1_000",
+			"MODE":    "0o644",
+			"MEMORY":  "512MiB",
+			"BUFFER":  "32KiB",
+			"LIMITS":  `["1KB", 2, "3 KiB"]`,
+			"RATIO":   "12.5%",
+			"WEIGHTS": `["50%", 0.25]`,
+		})}
+		Expect(it.Unmarshal(&fx)).To(Succeed())
+		Expect(fx).To(Equal(sized{
+			Count:   1000,
+			Mode:    0644,
+			Memory:  512 << 20,
+			Buffer:  32 << 10,
+			Limits:  []int{1000, 2, 3072},
+			Ratio:   0.125,
+			Weights: []float32{0.5, 0.25},
+		}))
+	})
+
+	It("report errors with the field's key", func() {
+		it := implementation{source: stubEnvironment(map[string]string{
+			"BUFFER": "1MiB",
+			"RATIO":  "lots",
+		})}
+		err := it.Unmarshal(&sized{})
+		Expect(err).To(HaveOccurred())
+		Expect(err.(Errors)).To(ConsistOf(
+			&BadValue{Name: Key{"Buffer"}, Cause: &strconv.NumError{Func: "ParseBytes", Num: "1MiB", Err: strconv.ErrRange}},
+			&BadValue{Name: Key{"Ratio"}, Cause: &strconv.NumError{Func: "ParsePercent", Num: "lots", Err: strconv.ErrSyntax}},
+		))
+
+		fx := struct {
+			Name string `flatpack:"bytes"`
+			Rate int    `flatpack:"percent"`
+		}{}
+		it = implementation{source: stubEnvironment(map[string]string{"NAME": "1KB", "RATE": "5%"})}
+		err = it.Unmarshal(&fx)
+		Expect(err).To(MatchError(ContainSubstring("bytes needs a numeric field (name=Name,kind=string)")))
+		Expect(err).To(MatchError(ContainSubstring("percent needs a floating-point field (name=Rate,kind=int)")))
+	})
+})
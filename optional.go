@@ -0,0 +1,113 @@
+package flatpack
+
+import "reflect"
+
+// Optional is a field type that records whether the data source supplied a
+// value, which saves you from declaring a pointer just to tell an unset value
+// from its zero value:
+//
+//	type Config struct {
+//		Timeout flatpack.Optional[float64]
+//		Ports   []flatpack.Optional[int]
+//	}
+//
+//	if timeout, ok := config.Timeout.Get(); ok {
+//		...
+//	}
+//
+// The type parameter may be any type that Unmarshal can read from a single
+// key, i.e. a scalar or a slice of scalars. In a slice of Optional, JSON null
+// elements are left unset. Field tags apply to the value as if it weren't
+// wrapped.
+type Optional[T any] struct {
+	value T
+	set   bool
+	key   Key
+}
+
+// Some returns an Optional whose value is set, e.g. to initialize a config
+// by hand.
+func Some[T any](value T) Optional[T] {
+	return Optional[T]{value: value, set: true}
+}
+
+// Get returns the value and whether it was set.
+func (o Optional[T]) Get() (T, bool) {
+	return o.value, o.set
+}
+
+// OrElse returns the value if it was set, or def otherwise.
+func (o Optional[T]) OrElse(def T) T {
+	if o.set {
+		return o.value
+	}
+	return def
+}
+
+// Key returns the key from which the value was read, or nil if it wasn't read
+// by Unmarshal.
+func (o Optional[T]) Key() Key {
+	return o.key
+}
+
+func (o Optional[T]) peek() (interface{}, bool) {
+	return o.value, o.set
+}
+
+func (o *Optional[T]) target() interface{} {
+	return &o.value
+}
+
+func (o *Optional[T]) mark(name Key) {
+	o.set, o.key = true, name
+}
+
+func (o *Optional[T]) reset() {
+	*o = Optional[T]{}
+}
+
+// Implemented by *Optional[T], so that reflection can reach its value.
+type optional interface {
+	// peek returns the value and whether it is set
+	peek() (interface{}, bool)
+	// target returns a pointer to the value
+	target() interface{}
+	// mark records that the value was read from name
+	mark(name Key)
+	// reset unsets the value
+	reset()
+}
+
+var optionalType = reflect.TypeOf((*optional)(nil)).Elem()
+
+// Return the type of value held by an Optional type, or nil if t isn't one.
+func optionalElem(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Struct && reflect.PointerTo(t).Implements(optionalType) {
+		return t.Field(0).Type
+	}
+	return nil
+}
+
+// Return the type of the values held by a slice type, looking through
+// pointers and Optional.
+func sliceElem(t reflect.Type) reflect.Type {
+	elem := t.Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if inner := optionalElem(elem); inner != nil {
+		elem = inner
+	}
+	return elem
+}
+
+// Return the value held by an Optional, and whether it is set.
+func optionalValue(v reflect.Value) (reflect.Value, bool) {
+	value, set := v.Interface().(interface{ peek() (interface{}, bool) }).peek()
+	return reflect.ValueOf(value), set
+}
+
+// Return the addressable value held by an addressable Optional.
+func optionalTarget(v reflect.Value) reflect.Value {
+	return reflect.ValueOf(v.Addr().Interface().(optional).target()).Elem()
+}
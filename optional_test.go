@@ -0,0 +1,122 @@
+package flatpack
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type optionals struct {
+	Port    Optional[int]
+	Ratio   Optional[float64] `flatpack:"default=0.5"`
+	Name    Optional[string]  `flatpack:"nonempty"`
+	Hosts   Optional[[]string]
+	Token   Optional[Secret]
+	Weights []Optional[int] `flatpack:"max=3,min=1"`
+	Nested  struct {
+		Debug Optional[bool]
+	}
+	Pointer *Optional[uint]
+}
+
+var _ = Describe("Optional", func() {
+	It("reports whether it is set", func() {
+		unset := Optional[int]{}
+		value, ok := unset.Get()
+		Expect(value).To(Equal(0))
+		Expect(ok).To(BeFalse())
+		Expect(unset.OrElse(42)).To(Equal(42))
+		Expect(unset.Key()).To(BeNil())
+
+		value, ok = Some(7).Get()
+		Expect(value).To(Equal(7))
+		Expect(ok).To(BeTrue())
+		Expect(Some(7).OrElse(42)).To(Equal(7))
+	})
+
+	It("is populated by Unmarshal", func() {
+		fx := optionals{Port: Some(1)}
+		it := implementation{source: stubEnvironment(map[string]string{
+			"NAME":         "app",
+			"HOSTS":        `["a","b"]`,
+			"TOKEN":        "hush",
+			"WEIGHTS":      "[1,null,3]",
+			"NESTED_DEBUG": "true",
+			"POINTER":      "9",
+		})}
+		Expect(it.Unmarshal(&fx)).To(Succeed())
+
+		_, ok := fx.Port.Get()
+		Expect(ok).To(BeFalse())
+		Expect(fx.Ratio.OrElse(0)).To(Equal(0.5))
+		Expect(fx.Name.OrElse("")).To(Equal("app"))
+		Expect(fx.Name.Key()).To(Equal(Key{"Name"}))
+		Expect(fx.Hosts.OrElse(nil)).To(Equal([]string{"a", "b"}))
+		Expect(fx.Token.OrElse("")).To(Equal(Secret("hush")))
+		Expect(fx.Weights).To(Equal([]Optional[int]{
+			{value: 1, set: true, key: Key{"Weights"}},
+			{},
+			{value: 3, set: true, key: Key{"Weights"}},
+		}))
+		Expect(fx.Nested.Debug.OrElse(false)).To(BeTrue())
+		Expect(fx.Nested.Debug.Key()).To(Equal(Key{"Nested", "Debug"}))
+		Expect(fx.Pointer.OrElse(0)).To(Equal(uint(9)))
+	})
+
+	It("is set by empty lists", func() {
+		for _, hosts := range []string{"[]", ""} {
+			fx := optionals{}
+			it := implementation{source: stubEnvironment(map[string]string{"HOSTS": hosts})}
+			Expect(it.Unmarshal(&fx)).To(Succeed())
+			value, ok := fx.Hosts.Get()
+			Expect(ok).To(BeTrue(), hosts)
+			Expect(value).To(Equal([]string{}))
+		}
+	})
+
+	It("applies field tags to its value", func() {
+		fx := optionals{}
+		it := implementation{source: stubEnvironment(map[string]string{
+			"NAME":    "",
+			"WEIGHTS": "[1,2,3,4]",
+			"TOKEN":   "[",
+			"PORT":    "x",
+		})}
+		err := it.Unmarshal(&fx)
+		Expect(err).To(HaveOccurred())
+		Expect(err.(Errors)).To(ConsistOf(
+			BeAssignableToTypeOf(&BadValue{}),
+			&InvalidValue{Name: Key{"Name"}, Rule: "nonempty"},
+			&InvalidValue{Name: Key{"Weights"}, Rule: "max=3"},
+		))
+	})
+
+	It("is traversed like a pointer", func() {
+		fx := optionals{Port: Some(80), Token: Some(Secret("hush")), Weights: []Optional[int]{Some(1), {}}}
+		env, err := Marshal(&fx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(Equal(map[string]string{"PORT": "80", "TOKEN": "hush", "WEIGHTS": "[1,null]"}))
+
+		vars, err := Variables(&optionals{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vars).To(HaveLen(8))
+		Expect(vars[0].Type.Kind().String()).To(Equal("int"))
+
+		redacted := Redacted(&fx).(*optionals)
+		Expect(redacted.Port.OrElse(0)).To(Equal(80))
+		Expect(redacted.Token.OrElse("")).To(Equal(Secret(Mask)))
+		Expect(fx.Token.OrElse("")).To(Equal(Secret("hush")))
+	})
+
+	It("can't hold structs", func() {
+		fx := struct {
+			Nested Optional[struct{ Foo string }]
+		}{}
+		err := implementation{source: stubEnvironment(map[string]string{"NESTED_FOO": "foo"})}.Unmarshal(&fx)
+		Expect(err).To(MatchError(ContainSubstring("unsupported optional type")))
+
+		_, err = Variables(&fx)
+		Expect(err).To(MatchError(ContainSubstring("unsupported optional type")))
+		_, err = Marshal(&fx)
+		Expect(err).To(MatchError(ContainSubstring("unsupported optional type")))
+	})
+})
@@ -0,0 +1,188 @@
+package flatpack
+
+import (
+	"reflect"
+	"sync"
+)
+
+// A plan for reading a struct type: which fields to read, under which names,
+// and how. Plans are compiled once per type by planFor, so that repeated
+// calls to Unmarshal don't have to inspect the type, parse its tags or
+// compute its keys all over again.
+type plan struct {
+	fields []fieldPlan
+	// embedded are the index paths of the embedded pointers through which
+	// fields are promoted
+	embedded [][]int
+	// err, if not nil, is why the struct can't be read, e.g. because it
+	// has unexported fields or a malformed tag
+	err error
+}
+
+// A plan for reading one field of a struct.
+type fieldPlan struct {
+	field reflect.StructField
+	tags  tags
+	// name is the field's key, relative to the root of the plan; it must
+	// not be modified
+	name Key
+	// env is name.AsEnv()
+	env string
+	// decode converts strings into values of the field's scalar type, or of
+	// the elements of its slice type
+	decode decoder
+	// empty means an empty value is a value, not the lack of one
+	empty bool
+	// optional is the plan for the value held by an Optional field, if the
+	// field is one
+	optional *fieldPlan
+	// elemOptional means the elements of the field's slice type are Optional
+	elemOptional bool
+	// plan is the plan for the struct that the field holds or points to,
+	// if any
+	plan *plan
+}
+
+// A decoder converts a string into a scalar value and assigns it to dest.
+type decoder func(f implementation, dest reflect.Value, source string, name Key) error
+
+// Plans for struct types that have been unmarshalled; maps reflect.Type to
+// *plan.
+var plans sync.Map
+
+// Return the plan for unmarshalling into a struct type, compiling it on first
+// use.
+func planFor(t reflect.Type) *plan {
+	if p, ok := plans.Load(t); ok {
+		return p.(*plan)
+	}
+	p, _ := plans.LoadOrStore(t, compile(Key{}, t, map[reflect.Type]bool{}))
+	return p.(*plan)
+}
+
+// Compile a plan for reading a struct type whose fields are named relative to
+// prefix. The compiling set holds the types that enclose this one, to detect
+// recursive types.
+func compile(prefix Key, t reflect.Type, compiling map[reflect.Type]bool) *plan {
+	fields, err := fieldsOf(prefix, t)
+	if err != nil {
+		return &plan{err: err}
+	}
+
+	compiling[t] = true
+	defer delete(compiling, t)
+
+	p := &plan{fields: make([]fieldPlan, len(fields)), embedded: embeddedPointers(t, fields)}
+	for i := range fields {
+		field := &fields[i]
+		name := make(Key, len(prefix)+1)
+		copy(name, prefix)
+		name[len(prefix)] = field.Name
+
+		fp := &p.fields[i]
+		fp.field = *field
+		fp.tags = parseTags(field)
+		if err := fp.tags.malformed(name, field.Type.Kind()); err != nil {
+			return &plan{err: err}
+		}
+		fp.name = name
+		fp.env = name.AsEnv()
+		compileType(fp, field.Type, compiling)
+	}
+	return p
+}
+
+// Work out how to read a value of type t into a field.
+func compileType(fp *fieldPlan, t reflect.Type, compiling map[reflect.Type]bool) {
+	elem := t
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if inner := optionalElem(elem); inner != nil {
+		fp.optional = &fieldPlan{field: fp.field, tags: fp.tags, name: fp.name, env: fp.env}
+		compileType(fp.optional, inner, compiling)
+		return
+	}
+
+	if fp.tags.json {
+		// the whole value, pointers and all, comes from one JSON document
+		fp.decode = implementation.decodeJSON
+		return
+	}
+
+	fp.empty = acceptsEmpty(elem.Kind(), fp.tags)
+	switch {
+	case elem.Kind() == reflect.Struct && compiling[elem]:
+		fp.plan = &plan{err: &BadType{Name: fp.name, Kind: elem.Kind(), reason: "recursive type"}}
+	case elem.Kind() == reflect.Struct:
+		fp.plan = compile(fp.name, elem, compiling)
+	case elem.Kind() == reflect.Slice:
+		e := elem.Elem()
+		if e.Kind() == reflect.Ptr {
+			e = e.Elem()
+		}
+		fp.elemOptional = optionalElem(e) != nil
+		if inner := sliceElem(elem); inner.Kind() == reflect.Slice {
+			fp.decode = sliceDecoder(inner, fp.tags)
+			return
+		}
+		elem = sliceElem(elem)
+	}
+	fp.decode = decoderFor(elem.Kind(), fp.tags)
+}
+
+// Return the decoder for a slice that is an element of another slice. It
+// reads a JSON array, decoding each element in turn, so that slices may be
+// nested to any depth.
+func sliceDecoder(t reflect.Type, tags tags) decoder {
+	e := t.Elem()
+	if e.Kind() == reflect.Ptr {
+		e = e.Elem()
+	}
+	elemOptional := optionalElem(e) != nil
+	elem := sliceElem(t)
+	decode := decoderFor(elem.Kind(), tags)
+	if elem.Kind() == reflect.Slice {
+		decode = sliceDecoder(elem, tags)
+	}
+	return func(f implementation, dest reflect.Value, source string, name Key) error {
+		elems, nulls, err := splitNullableJSON(source)
+		if err != nil {
+			return &BadValue{Name: name, Cause: err}
+		}
+		return f.decodeElems(dest, elems, nulls, elemOptional, decode, name)
+	}
+}
+
+// Determine whether an empty value is a value for a field of the given kind,
+// once pointers are stripped, rather than the lack of one.
+func acceptsEmpty(kind reflect.Kind, tags tags) bool {
+	return (kind == reflect.String || kind == reflect.Slice) && !tags.ignoreEmpty
+}
+
+// Return the decoder for a scalar kind, or for the format that the field's
+// tags call for. For any other kind, return one that fails with BadType.
+func decoderFor(kind reflect.Kind, tags tags) decoder {
+	switch {
+	case tags.bytes:
+		return implementation.decodeBytes
+	case tags.percent:
+		return implementation.decodePercent
+	}
+	switch kind {
+	case reflect.Bool:
+		return implementation.decodeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return implementation.decodeInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return implementation.decodeUint
+	case reflect.Float32, reflect.Float64:
+		return implementation.decodeFloat
+	case reflect.Complex64, reflect.Complex128:
+		return implementation.decodeComplex
+	case reflect.String:
+		return implementation.decodeString
+	}
+	return implementation.decodeUnsupported
+}
@@ -0,0 +1,49 @@
+package flatpack
+
+import (
+	"reflect"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// For testing recursive types
+type recursive struct {
+	Name string
+	Next *recursive
+}
+
+var _ = Describe("plan", func() {
+	It("is compiled once per type", func() {
+		p := planFor(reflect.TypeOf(simple{}))
+		Expect(planFor(reflect.TypeOf(simple{}))).To(BeIdenticalTo(p))
+		Expect(p.fields).To(HaveLen(4))
+		Expect(p.fields[2].plan.fields[1].name).To(Equal(Key{"Baz", "Bar"}))
+		Expect(p.fields[2].plan.fields[1].env).To(Equal("BAZ_BAR"))
+	})
+
+	It("records unexported fields", func() {
+		p := planFor(reflect.TypeOf(badField{}))
+		Expect(p.err).To(BeAssignableToTypeOf(&NoReflection{}))
+	})
+
+	It("rejects recursive types", func() {
+		fx := recursive{}
+		err := New(stubEnvironment(map[string]string{"NAME": "a", "NEXT_NAME": "b"})).Unmarshal(&fx)
+		Expect(err).To(MatchError("flatpack: invalid type; recursive type (name=Next,kind=struct)"))
+	})
+
+	It("rejects recursive types when documenting them", func() {
+		_, err := Variables(&recursive{})
+		Expect(err).To(MatchError("flatpack: invalid type; recursive type (name=Next,kind=struct)"))
+		_, err = Schema(&recursive{})
+		Expect(err).To(MatchError("flatpack: invalid type; recursive type (name=Next,kind=struct)"))
+	})
+
+	It("hands out keys that callers may modify", func() {
+		vars, err := Variables(&simple{})
+		Expect(err).NotTo(HaveOccurred())
+		vars[0].Name[0] = "Changed"
+		Expect(planFor(reflect.TypeOf(simple{})).fields[0].name).To(Equal(Key{"Foo"}))
+	})
+})
@@ -1,13 +1,81 @@
 package flatpack
 
+import (
+	"os"
+	"strings"
+)
+
 // A getter that reads configuration data from the process environment (or
 // something similar).
 type processEnvironment struct {
 	lookup func(string) (string, bool)
 }
 
+// CaseInsensitiveEnvironment returns a Getter that reads the process
+// environment like the default DataSource, but ignores the case of variable
+// names, for platforms that lowercase or otherwise mangle them. The
+// environment is indexed once, when this is called; variables set later are
+// not seen. If several variables differ only in case, the upper-case one
+// wins.
+func CaseInsensitiveEnvironment() Getter {
+	return caseInsensitive(os.Environ())
+}
+
+// Index a list of NAME=value pairs, like os.Environ returns, by upper-case
+// name.
+func caseInsensitive(environ []string) *processEnvironment {
+	index := make(map[string]string, len(environ))
+	for _, pair := range environ {
+		name, value, _ := strings.Cut(pair, "=")
+		if name == "" {
+			// e.g. the =C:=C:\ variables of Windows
+			continue
+		}
+		upper := strings.ToUpper(name)
+		if _, seen := index[upper]; !seen || name == upper {
+			index[upper] = value
+		}
+	}
+	return &processEnvironment{func(env string) (string, bool) {
+		value, ok := index[strings.ToUpper(env)]
+		return value, ok
+	}}
+}
+
 func (pe processEnvironment) Get(name Key) (string, error) {
-	key := name.AsEnv()
-	value, _ := pe.lookup(key)
-	return value, nil
+	value, _, err := pe.lookupEnv(name.AsEnv())
+	return value, err
+}
+
+// Lookup implements Lookuper; a variable is set if it is defined, even if
+// its value is empty.
+func (pe processEnvironment) Lookup(name Key) (string, bool, error) {
+	return pe.lookupEnv(name.AsEnv())
+}
+
+// A Lookuper that can look values up by their environment variable names,
+// which saves Unmarshal from calling Key.AsEnv for every field.
+type envLookuper interface {
+	lookupEnv(env string) (string, bool, error)
+}
+
+func (pe processEnvironment) lookupEnv(env string) (string, bool, error) {
+	value, ok := pe.lookup(env)
+	return value, ok, nil
+}
+
+func (pe processEnvironment) Describe(name Key) string {
+	return "environment"
+}
+
+// GetProfile implements ProfileGetter; profile-specific variables are named
+// like PROFILE__NAME.
+func (pe processEnvironment) GetProfile(profile string, name Key) (string, error) {
+	value, _, err := pe.lookupProfile(profile, name)
+	return value, err
+}
+
+func (pe processEnvironment) lookupProfile(profile string, name Key) (string, bool, error) {
+	value, ok := pe.lookup(Key{profile}.AsEnv() + "__" + name.AsEnv())
+	return value, ok, nil
 }
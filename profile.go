@@ -0,0 +1,109 @@
+package flatpack
+
+import "context"
+
+// ProfileGetter is a Getter that knows how to store profile-specific values.
+// Getters that don't implement it are assumed to keep each profile's values
+// in a section of its own, i.e. under keys prefixed with the profile name.
+type ProfileGetter interface {
+	Getter
+	// GetProfile returns the value for name that applies only to the given
+	// profile, or the empty string if there is none.
+	GetProfile(profile string, name Key) (string, error)
+}
+
+// Profile is a Getter that overlays the values of one profile, e.g. "staging"
+// or "prod", over the base values of another Getter. If the active profile
+// has a value for a key, it shadows the base value. This makes it possible
+// to deploy the same program with the same data source to several
+// environments.
+//
+// In the process environment, profile-specific variables are named with the
+// profile, two underscores and the usual variable name, e.g.
+// STAGING__DATABASE_HOST.
+//
+// To let base values refer to profile-specific ones, wrap the Profile in an
+// Expander rather than the other way around.
+type Profile struct {
+	source Getter
+	name   string
+}
+
+// NewProfile returns a Getter that overlays the values of the named profile
+// over those of source.
+func NewProfile(source Getter, name string) *Profile {
+	return &Profile{source: source, name: name}
+}
+
+// WithProfile makes an Unmarshaller overlay the values of the named profile
+// over those of its data source; see Profile.
+func WithProfile(name string) Option {
+	return func(f *implementation) {
+		f.profile = name
+	}
+}
+
+// WithProfileFrom makes an Unmarshaller read the name of the active profile
+// from its data source, under the given key, before it unmarshals anything.
+// For example, WithProfileFrom(Key{"App", "Profile"}) selects a profile by
+// means of the APP_PROFILE environment variable. If the key has no value, the
+// profile given to WithProfile is active, if any.
+func WithProfileFrom(name Key) Option {
+	return func(f *implementation) {
+		f.profileKey = name
+	}
+}
+
+// Get returns the profile-specific value for name if there is one, or the
+// base value otherwise.
+func (p *Profile) Get(name Key) (string, error) {
+	value, _, err := p.Lookup(name)
+	return value, err
+}
+
+// Lookup implements Lookuper. A profile-specific value that is set but empty
+// shadows the base value, if the underlying source can tell.
+func (p *Profile) Lookup(name Key) (string, bool, error) {
+	value, ok, err := lookupProfile(p.source, p.name, name)
+	if err == nil && !ok {
+		return lookup(p.source, name)
+	}
+	return value, ok, err
+}
+
+// Describe implements Describer, mentioning the profile if the value for
+// name is profile-specific.
+func (p *Profile) Describe(name Key) string {
+	source := describe(p.source, name)
+	if _, ok, err := lookupProfile(p.source, p.name, name); err == nil && ok {
+		source += " (profile " + p.name + ")"
+	}
+	return source
+}
+
+// Changes implements Watchable by asking the underlying source, or by
+// polling if it isn't Watchable.
+func (p *Profile) Changes(ctx context.Context) <-chan struct{} {
+	if watchable, ok := p.source.(Watchable); ok {
+		return watchable.Changes(ctx)
+	}
+	return poll(ctx, WatchInterval)
+}
+
+// A ProfileGetter that can tell a profile-specific value that is set but
+// empty from one that isn't set, like a Lookuper.
+type profileLookuper interface {
+	lookupProfile(profile string, name Key) (string, bool, error)
+}
+
+// Look up the value of name that is specific to the given profile.
+func lookupProfile(source Getter, profile string, name Key) (string, bool, error) {
+	switch profiler := source.(type) {
+	case profileLookuper:
+		return profiler.lookupProfile(profile, name)
+	case ProfileGetter:
+		value, err := profiler.GetProfile(profile, name)
+		return value, value != "", err
+	}
+	return lookup(source, append(Key{profile}, name...))
+}
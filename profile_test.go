@@ -0,0 +1,83 @@
+package flatpack
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Profile", func() {
+	env := map[string]string{
+		"FOO":             "base",
+		"BAZ_BAR":         "1",
+		"STAGING__FOO":    "staging",
+		"STAGING_BAZ_FOO": "sectioned",
+		"APP_PROFILE":     "staging",
+	}
+
+	It("shadows base values with profile-specific ones", func() {
+		profile := NewProfile(stubEnvironment(env), "staging")
+		Expect(profile.Get(Key{"Foo"})).To(Equal("staging"))
+		Expect(profile.Get(Key{"Baz", "Bar"})).To(Equal("1"))
+		Expect(profile.Get(Key{"Baz", "Quux"})).To(Equal(""))
+	})
+
+	It("shadows base values with empty profile-specific ones", func() {
+		env := map[string]string{"FOO": "base", "STAGING__FOO": ""}
+		for _, source := range []Getter{stubEnvironment(env), NewExpander(NewCache(stubEnvironment(env), 0))} {
+			value, ok, err := NewProfile(source, "staging").Lookup(Key{"Foo"})
+			Expect(value, err).To(Equal(""))
+			Expect(ok).To(BeTrue())
+		}
+		value, ok, err := NewProfile(stubEnvironment(env), "prod").Lookup(Key{"Foo"})
+		Expect(value, err).To(Equal("base"))
+		Expect(ok).To(BeTrue())
+	})
+
+	It("reads sections of sources that aren't ProfileGetters", func() {
+		source := &countingGetter{source: stubEnvironment(env), calls: map[string]int{}}
+		profile := NewProfile(source, "staging")
+		Expect(profile.Get(Key{"Baz", "Foo"})).To(Equal("sectioned"))
+		Expect(profile.Get(Key{"Foo"})).To(Equal("base"))
+	})
+
+	It("passes through a Cache and an Expander", func() {
+		env := map[string]string{"URL": "http://${HOST}", "HOST": "prod", "STAGING__HOST": "staging"}
+		profile := NewExpander(NewProfile(NewCache(stubEnvironment(env), 0), "staging"))
+		Expect(profile.Get(Key{"URL"})).To(Equal("http://staging"))
+		Expect(NewExpander(stubEnvironment(env)).Get(Key{"URL"})).To(Equal("http://prod"))
+
+		env["STAGING__URL"] = "https://${HOST}"
+		Expect(NewProfile(NewExpander(stubEnvironment(env)), "staging").Get(Key{"URL"})).To(Equal("https://staging"))
+	})
+
+	It("is selected by option", func() {
+		fx := simple{}
+		Expect(New(stubEnvironment(env), WithProfile("staging")).Unmarshal(&fx)).To(Succeed())
+		Expect(fx.Foo).To(Equal("staging"))
+		Expect(fx.Baz.Bar).To(Equal(1))
+
+		fx = simple{}
+		Expect(New(stubEnvironment(env)).Unmarshal(&fx)).To(Succeed())
+		Expect(fx.Foo).To(Equal("base"))
+	})
+
+	It("is selected by a variable", func() {
+		fx := simple{}
+		Expect(New(stubEnvironment(env), WithProfileFrom(Key{"App", "Profile"})).Unmarshal(&fx)).To(Succeed())
+		Expect(fx.Foo).To(Equal("staging"))
+
+		fx = simple{}
+		Expect(New(stubEnvironment(env), WithProfileFrom(Key{"Missing"})).Unmarshal(&fx)).To(Succeed())
+		Expect(fx.Foo).To(Equal("base"))
+	})
+
+	It("describes profile-specific values", func() {
+		fx := simple{}
+		report, err := New(stubEnvironment(env), WithProfile("staging")).UnmarshalWithReport(&fx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report[0].Name).To(Equal(Key{"Foo"}))
+		Expect(report[0].Source).To(Equal("environment (profile staging)"))
+		Expect(report[1].Name).To(Equal(Key{"Baz", "Bar"}))
+		Expect(report[1].Source).To(Equal("environment"))
+	})
+})
@@ -0,0 +1,94 @@
+package flatpack
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Describer is a Getter that can say where a value came from, e.g.
+// "environment" or "config.env:12". Getters that implement it make
+// provenance reports more useful.
+type Describer interface {
+	Getter
+	// Describe returns a short human-readable description of the origin of
+	// the value for name.
+	Describe(name Key) string
+}
+
+// Provenance records where the value of a single field came from.
+type Provenance struct {
+	// Name is the key of the field.
+	Name Key
+	// Source describes where the value came from. It is "default" if the
+	// value came from a flatpack:"default=..." tag.
+	Source string
+	// Raw is the string that was read from the source.
+	Raw string
+	// Value is the value that was assigned to the field after parsing Raw.
+	//
+	// Both Raw and Value are Mask if the field is secret.
+	Value interface{}
+}
+
+// Report lists the fields that were set by UnmarshalWithReport, in the order
+// that they were set.
+type Report []Provenance
+
+// UnmarshalWithReport reads configuration data from the package's DataSource
+// into a struct, like Unmarshal, and also reports where each value came from.
+func UnmarshalWithReport(dest interface{}) (Report, error) {
+	return New(DataSource).UnmarshalWithReport(dest)
+}
+
+// UnmarshalWithReport reads configuration data from some source into a
+// struct and reports where each value came from. If an error occurs, the
+// report describes the fields that were set before the error.
+func (f implementation) UnmarshalWithReport(dest interface{}) (Report, error) {
+	f.report = &Report{}
+	err := f.Unmarshal(dest)
+	return *f.report, err
+}
+
+// WriteTo prints the report to w as a table with one row per field.
+func (r Report) WriteTo(w io.Writer) (int64, error) {
+	buf := bytes.Buffer{}
+	tw := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSOURCE\tRAW\tVALUE")
+	for _, p := range r {
+		fmt.Fprintf(tw, "%s\t%s\t%q\t%v\n", p.Name.AsEnv(), p.Source, p.Raw, p.Value)
+	}
+	tw.Flush()
+	return buf.WriteTo(w)
+}
+
+// Record the provenance of a field that has just been assigned, if anyone
+// is interested.
+func (f implementation) record(name Key, tags tags, fromDefault bool, raw string, value interface{}) {
+	if f.report == nil {
+		return
+	}
+	source := "default"
+	if !fromDefault {
+		source = describe(f.source, name)
+	}
+	if tags.secret {
+		raw, value = Mask, Mask
+	}
+	*f.report = append(*f.report, Provenance{
+		Name:   append(Key{}, name...),
+		Source: source,
+		Raw:    raw,
+		Value:  value,
+	})
+}
+
+// Describe where a Getter's value came from, falling back on its type name if
+// it is not a Describer.
+func describe(source Getter, name Key) string {
+	if describer, ok := source.(Describer); ok {
+		return describer.Describe(name)
+	}
+	return fmt.Sprintf("%T", source)
+}
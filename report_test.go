@@ -0,0 +1,84 @@
+package flatpack
+
+import (
+	"bytes"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type reported struct {
+	Host    string `flatpack:"default=localhost"`
+	Port    int
+	Hosts   []string
+	Missing string
+	Nested  *struct {
+		Timeout float64
+	}
+}
+
+var _ = Describe("UnmarshalWithReport()", func() {
+	env := map[string]string{
+		"PORT":           "80",
+		"HOSTS":          `["a","b"]`,
+		"NESTED_TIMEOUT": "2.5",
+	}
+
+	It("reports where each value came from", func() {
+		got := reported{}
+		report, err := implementation{source: stubEnvironment(env)}.UnmarshalWithReport(&got)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report).To(Equal(Report{
+			{Name: Key{"Host"}, Source: "default", Raw: "localhost", Value: "localhost"},
+			{Name: Key{"Port"}, Source: "environment", Raw: "80", Value: 80},
+			{Name: Key{"Hosts"}, Source: "environment", Raw: `["a","b"]`, Value: []string{"a", "b"}},
+			{Name: Key{"Nested", "Timeout"}, Source: "environment", Raw: "2.5", Value: 2.5},
+		}))
+	})
+
+	It("falls back on the type of the data source", func() {
+		got := reported{}
+		report, err := implementation{source: &mutableEnvironment{pairs: env}}.UnmarshalWithReport(&got)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report[1].Source).To(Equal("*flatpack.mutableEnvironment"))
+	})
+
+	It("asks the source underlying a Cache", func() {
+		got := reported{}
+		report, err := implementation{source: NewCache(stubEnvironment(env), 0)}.UnmarshalWithReport(&got)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report[1].Source).To(Equal("environment"))
+	})
+
+	It("reports fields that were set before an error", func() {
+		got := reported{}
+		bad := map[string]string{"PORT": "80", "HOSTS": "oops"}
+		report, err := implementation{source: stubEnvironment(bad)}.UnmarshalWithReport(&got)
+		Expect(err).To(HaveOccurred())
+		Expect(report).To(HaveLen(2))
+	})
+
+	It("uses the package's DataSource", func() {
+		DataSource = stubEnvironment(env)
+		defer func() { DataSource = processEnvironment{os.LookupEnv} }()
+		got := reported{}
+		report, err := UnmarshalWithReport(&got)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report).To(HaveLen(4))
+	})
+
+	It("prints a table", func() {
+		buf := bytes.Buffer{}
+		report := Report{
+			{Name: Key{"Host"}, Source: "default", Raw: "localhost", Value: "localhost"},
+			{Name: Key{"Port"}, Source: "environment", Raw: "80", Value: 80},
+		}
+		_, err := report.WriteTo(&buf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buf.String()).To(Equal(
+			"NAME  SOURCE       RAW          VALUE\n" +
+				"HOST  default      \"localhost\"  localhost\n" +
+				"PORT  environment  \"80\"         80\n"))
+	})
+})
@@ -0,0 +1,270 @@
+package flatpack
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSONSchema is a subset of JSON Schema (draft 2020-12) that is sufficient
+// to describe the environment variables read by Unmarshal.
+type JSONSchema struct {
+	Schema      string                 `json:"$schema,omitempty"`
+	Type        string                 `json:"type,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Default     interface{}            `json:"default,omitempty"`
+	Enum        []interface{}          `json:"enum,omitempty"`
+	Minimum     json.Number            `json:"minimum,omitempty"`
+	Maximum     json.Number            `json:"maximum,omitempty"`
+	MinLength   json.Number            `json:"minLength,omitempty"`
+	MaxLength   json.Number            `json:"maxLength,omitempty"`
+	Pattern     string                 `json:"pattern,omitempty"`
+	Format      string                 `json:"format,omitempty"`
+	MinItems    json.Number            `json:"minItems,omitempty"`
+	MaxItems    json.Number            `json:"maxItems,omitempty"`
+	Items       *JSONSchema            `json:"items,omitempty"`
+	Properties  map[string]*JSONSchema `json:"properties,omitempty"`
+	Deprecated  bool                   `json:"deprecated,omitempty"`
+	Required    []string               `json:"required,omitempty"`
+}
+
+// Schema returns a JSON Schema that describes the environment variables read
+// by Unmarshal into config, as an object whose properties are the variable
+// names. Tooling can use it to validate configuration before it reaches
+// the program.
+//
+// The config may be anything accepted by Variables. Property types are
+// derived from field types; variables that hold slices are described as
+// arrays, since that's what Unmarshal expects them to contain, and those
+// that hold structs or maps by way of the json tag as objects. Constraints
+// declared in field tags, such as min, max and oneof, become the equivalent
+// JSON Schema keywords. The defaults of secret fields are left out. Values
+// that may have units, by way of the bytes and percent tags, are described as
+// strings with a pattern, which leaves no room for rules.
+func Schema(config interface{}) (*JSONSchema, error) {
+	vars, err := Variables(config)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := &JSONSchema{
+		Schema:     "https://json-schema.org/draft/2020-12/schema",
+		Type:       "object",
+		Properties: make(map[string]*JSONSchema, len(vars)),
+	}
+	for _, v := range vars {
+		property := schemaFor(v.Type)
+		for _, r := range v.Rules {
+			name, arg, _ := strings.Cut(r, "=")
+			constrain(property, v.Type, name, arg)
+		}
+		if pattern, ok := unitPatterns[v.Format]; ok {
+			withUnits(property, pattern)
+		}
+		property.Description = v.Description
+		property.Deprecated = v.Deprecated
+		if v.Default != "" && !v.Secret {
+			if v.Format != "" {
+				property.Default = unitValue(v.Default)
+			} else {
+				property.Default = schemaValue(v.Type, v.Default)
+			}
+		}
+		name := v.Name.AsEnv()
+		schema.Properties[name] = property
+		if v.Required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema, nil
+}
+
+// Describe a Go type in JSON Schema terms.
+func schemaFor(t reflect.Type) *JSONSchema {
+	schema := &JSONSchema{}
+	switch t.Kind() {
+	case reflect.Bool:
+		schema.Type = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		schema.Type = "integer"
+		if bits := t.Bits(); bits < 64 {
+			schema.Minimum = json.Number(strconv.FormatInt(math.MinInt64>>(64-bits), 10))
+			schema.Maximum = json.Number(strconv.FormatInt(math.MaxInt64>>(64-bits), 10))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		schema.Type = "integer"
+		schema.Minimum = "0"
+		if bits := t.Bits(); bits < 64 {
+			schema.Maximum = json.Number(strconv.FormatUint(math.MaxUint64>>(64-bits), 10))
+		}
+	case reflect.Float32, reflect.Float64:
+		schema.Type = "number"
+	case reflect.Complex64, reflect.Complex128, reflect.String:
+		schema.Type = "string"
+	case reflect.Slice:
+		schema.Type = "array"
+		schema.Items = schemaFor(sliceElem(t))
+	case reflect.Array:
+		schema.Type = "array"
+		schema.Items = schemaFor(t.Elem())
+	case reflect.Struct, reflect.Map:
+		schema.Type = "object"
+	}
+	return schema
+}
+
+// Patterns that match the values of fields with the bytes and percent tags,
+// e.g. 512MiB or 12.5%, in the subset of regular expressions that JSON
+// Schema shares with Go.
+var unitPatterns = map[string]string{
+	"bytes":   `^\s*(0[xXoObB][0-9a-fA-F_]+|[0-9][0-9_]*|([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][+-]?[0-9]+)?)\s*(([KkMmGg][Ii]?)?[Bb])?\s*$`,
+	"percent": `^\s*[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][+-]?[0-9]+)?\s*%?\s*$`,
+}
+
+// Describe values that may have units as strings that match a pattern, since
+// JSON numbers can't have units. Rules apply to the values once they are
+// parsed, which the pattern can't express, so they are dropped.
+func withUnits(schema *JSONSchema, pattern string) {
+	for schema.Items != nil {
+		schema = schema.Items
+	}
+	*schema = JSONSchema{Type: "string", Pattern: pattern}
+}
+
+// Translate a rule declared in a field tag into the equivalent JSON Schema
+// keywords. Rules apply to the elements of slices, except for those that
+// constrain their length.
+func constrain(schema *JSONSchema, t reflect.Type, name, arg string) {
+	kind := t.Kind()
+	if kind == reflect.Slice {
+		switch name {
+		case "min":
+			schema.MinItems = schemaLimit(name, arg, true)
+		case "max":
+			schema.MaxItems = schemaLimit(name, arg, true)
+		case "nonempty":
+			schema.MinItems = "1"
+		default:
+			constrain(schema.Items, sliceElem(t), name, arg)
+		}
+		return
+	}
+
+	switch name {
+	case "min":
+		if kind == reflect.String {
+			schema.MinLength = schemaLimit(name, arg, true)
+		} else {
+			schema.Minimum = schemaLimit(name, arg, false)
+		}
+	case "max":
+		if kind == reflect.String {
+			schema.MaxLength = schemaLimit(name, arg, true)
+		} else {
+			schema.Maximum = schemaLimit(name, arg, false)
+		}
+	case "nonempty":
+		if kind == reflect.String {
+			schema.MinLength = "1"
+		}
+	case "oneof":
+		for _, choice := range strings.Split(arg, "|") {
+			if value := schemaValue(t, choice); value != nil {
+				schema.Enum = append(schema.Enum, value)
+			}
+		}
+	case "pattern":
+		schema.Pattern = arg
+	case "url":
+		schema.Format = "uri"
+	case "hostname", "email":
+		schema.Format = name
+	}
+}
+
+// Format the limit of a min or max rule as a JSON number, or return the
+// empty string if there is no such number. The limit is parsed as newRule
+// parses it. Limits on lengths are rounded to the nearest length that
+// satisfies them, since lengths are whole numbers.
+func schemaLimit(name, arg string, length bool) json.Number {
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(limit) || math.IsInf(limit, 0) {
+		return ""
+	}
+	switch {
+	case length && name == "min":
+		limit = math.Ceil(limit)
+	case length && name == "max":
+		limit = math.Floor(limit)
+	}
+	return json.Number(strconv.FormatFloat(limit, 'g', -1, 64))
+}
+
+// Convert a value in the format that Unmarshal reads into the equivalent
+// JSON value, for use as a default, or nil if there is none. Numbers are
+// parsed as Unmarshal parses them for a field of type t, so that e.g. 0x1F
+// becomes 31; those that it would reject, and those that JSON can't express,
+// such as NaN, have no equivalent.
+func schemaValue(t reflect.Type, value string) interface{} {
+	switch t.Kind() {
+	case reflect.Bool:
+		if boolean, err := strconv.ParseBool(value); err == nil {
+			return boolean
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, err := parseInt(value, t.Bits()); err == nil {
+			return json.Number(strconv.FormatInt(n, 10))
+		}
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		if n, err := parseUint(value, t.Bits()); err == nil {
+			return json.Number(strconv.FormatUint(n, 10))
+		}
+		return nil
+	case reflect.Float32, reflect.Float64:
+		if f, err := strconv.ParseFloat(value, t.Bits()); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return json.Number(strconv.FormatFloat(f, 'g', -1, t.Bits()))
+		}
+		return nil
+	case reflect.Slice, reflect.Array, reflect.Struct, reflect.Map, reflect.Interface:
+		if json.Valid([]byte(value)) {
+			return json.RawMessage(value)
+		}
+	}
+	return value
+}
+
+// Convert the default of a field whose values may have units into the
+// equivalent JSON value, in which those values are strings, e.g. "512MiB" or
+// ["1KiB", "1024"].
+func unitValue(value string) interface{} {
+	if !strings.HasPrefix(strings.TrimSpace(value), "[") {
+		return value
+	}
+	var array interface{}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	if err := decoder.Decode(&array); err != nil {
+		return value
+	}
+	return stringify(array)
+}
+
+// Replace the numbers in a decoded JSON value, and in the arrays that it
+// holds, with strings.
+func stringify(value interface{}) interface{} {
+	switch value := value.(type) {
+	case []interface{}:
+		for i := range value {
+			value[i] = stringify(value[i])
+		}
+		return value
+	case json.Number:
+		return string(value)
+	}
+	return value
+}
@@ -0,0 +1,141 @@
+package flatpack
+
+import (
+	"encoding/json"
+	"math"
+	"regexp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type schematic struct {
+	Port    uint16  `flatpack:"required,desc=Port to listen on"`
+	Offset  int8    `flatpack:"default=-3"`
+	Debug   bool    `flatpack:"default=true"`
+	Ratio   float64 `flatpack:"default=0.5"`
+	Name    string  `flatpack:"default=app"`
+	Hosts   []string
+	Weights []*int `flatpack:"default=[1,2]"`
+	Big     int64
+	Nested  struct {
+		URL string
+	}
+}
+
+type measured struct {
+	Memory int64     `flatpack:"bytes,default=512MiB,min=1"`
+	Limits []int     `flatpack:"bytes,max=3"`
+	Ratio  float64   `flatpack:"percent"`
+	Shares []float32 `flatpack:"percent"`
+}
+
+var _ = Describe("Schema()", func() {
+	It("describes every variable", func() {
+		schema, err := Schema(&schematic{})
+		Expect(err).NotTo(HaveOccurred())
+		data, err := json.Marshal(schema)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(`{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"type": "object",
+			"properties": {
+				"PORT": {"type": "integer", "description": "Port to listen on", "minimum": 0, "maximum": 65535},
+				"OFFSET": {"type": "integer", "default": -3, "minimum": -128, "maximum": 127},
+				"DEBUG": {"type": "boolean", "default": true},
+				"RATIO": {"type": "number", "default": 0.5},
+				"NAME": {"type": "string", "default": "app"},
+				"HOSTS": {"type": "array", "items": {"type": "string"}},
+				"WEIGHTS": {"type": "array", "default": [1,2], "items": {"type": "integer"}},
+				"BIG": {"type": "integer"},
+				"NESTED_URL": {"type": "string"}
+			},
+			"required": ["PORT"]
+		}`))
+	})
+
+	It("translates validation rules", func() {
+		schema, err := Schema(&constrained{})
+		Expect(err).NotTo(HaveOccurred())
+		data, err := json.Marshal(schema.Properties)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(`{
+			"PORT": {"type": "integer", "minimum": 1, "maximum": 65535},
+			"RATIO": {"type": "number", "minimum": 0, "maximum": 1},
+			"LEVEL": {"type": "string", "enum": ["debug", "info", "warn"]},
+			"NAME": {"type": "string", "pattern": "^[a-z]{2,8}$"},
+			"HOSTS": {"type": "array", "minItems": 1, "maxItems": 2, "items": {"type": "string", "format": "hostname"}},
+			"CODES": {"type": "array", "items": {"type": "integer", "enum": [200, 404]}},
+			"WEBSITE": {"type": "string", "format": "uri"},
+			"CONTACT": {"type": "string", "format": "email"}
+		}`))
+	})
+
+	It("describes values with units as strings", func() {
+		schema, err := Schema(&measured{Limits: []int{1024}, Ratio: 0.5})
+		Expect(err).NotTo(HaveOccurred())
+		bytes, percent := unitPatterns["bytes"], unitPatterns["percent"]
+		Expect(schema.Properties["MEMORY"]).To(Equal(&JSONSchema{Type: "string", Pattern: bytes, Default: "512MiB"}))
+		Expect(schema.Properties["LIMITS"]).To(Equal(&JSONSchema{
+			Type: "array", MaxItems: "3", Items: &JSONSchema{Type: "string", Pattern: bytes}, Default: []interface{}{"1024"},
+		}))
+		Expect(schema.Properties["RATIO"]).To(Equal(&JSONSchema{Type: "string", Pattern: percent, Default: "0.5"}))
+		Expect(schema.Properties["SHARES"].Items).To(Equal(&JSONSchema{Type: "string", Pattern: percent}))
+
+		for _, value := range []string{"512MiB", "1.5GB", "1 kib", "0x10", "1_000", "1e3B", "42", "0x1B", "0xB", "0x1 KiB"} {
+			_, err := parseBytes(value, 64)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(regexp.MustCompile(bytes).MatchString(value)).To(BeTrue(), value)
+		}
+		Expect(regexp.MustCompile(bytes).MatchString("lots")).To(BeFalse())
+		for _, value := range []string{"50%", "12.5 %", "0.5", "-1", ".5%"} {
+			_, err := parsePercent(value, 64)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(regexp.MustCompile(percent).MatchString(value)).To(BeTrue(), value)
+		}
+		Expect(regexp.MustCompile(percent).MatchString("half")).To(BeFalse())
+	})
+
+	It("leaves out non-finite defaults", func() {
+		schema, err := Schema(&struct {
+			Ratio float64 `flatpack:"default=+Inf"`
+			Scale float64
+		}{Scale: math.NaN()})
+		Expect(err).NotTo(HaveOccurred())
+		data, err := json.Marshal(schema.Properties)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(`{
+			"RATIO": {"type": "number"},
+			"SCALE": {"type": "number"}
+		}`))
+	})
+
+	It("writes numbers as JSON numbers whatever their Go syntax", func() {
+		schema, err := Schema(&struct {
+			Ratio float64  `flatpack:"default=.5,min=.5,max=+1"`
+			Mode  uint16   `flatpack:"default=0755"`
+			Flags int      `flatpack:"default=0x1F,oneof=1_000|0b1"`
+			Count int8     `flatpack:"default=1_0"`
+			Names []string `flatpack:"min=.5,max=2.5"`
+		}{})
+		Expect(err).NotTo(HaveOccurred())
+		data, err := json.Marshal(schema)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(`{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"type": "object",
+			"properties": {
+				"RATIO": {"type": "number", "default": 0.5, "minimum": 0.5, "maximum": 1},
+				"MODE": {"type": "integer", "default": 755, "minimum": 0, "maximum": 65535},
+				"FLAGS": {"type": "integer", "default": 31, "enum": [1000, 1]},
+				"COUNT": {"type": "integer", "default": 10, "minimum": -128, "maximum": 127},
+				"NAMES": {"type": "array", "items": {"type": "string"}, "minItems": 1, "maxItems": 2}
+			}
+		}`))
+	})
+
+	It("complains about unsupported types", func() {
+		_, err := Schema(&badType{})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,150 @@
+package flatpack
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Mask is printed in place of secret values.
+const Mask = "****"
+
+// Secret is a string that hides its value when formatted, so that it can't
+// accidentally end up in a log. Fields of this type are treated as if they
+// had the flatpack:"secret" field tag. Convert to string to use the value.
+type Secret string
+
+// String returns Mask.
+func (s Secret) String() string {
+	return Mask
+}
+
+// GoString returns Mask.
+func (s Secret) GoString() string {
+	return Mask
+}
+
+// Format prints Mask regardless of the verb.
+func (s Secret) Format(f fmt.State, verb rune) {
+	f.Write([]byte(Mask))
+}
+
+// MarshalJSON encodes Mask as a JSON string.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(Mask)), nil
+}
+
+var secretType = reflect.TypeOf(Secret(""))
+
+// Determine whether a type holds secrets on its own account, regardless of
+// field tags.
+func isSecretType(t reflect.Type) bool {
+	for {
+		switch {
+		case t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice:
+			t = t.Elem()
+		case optionalElem(t) != nil:
+			t = optionalElem(t)
+		default:
+			return t == secretType
+		}
+	}
+}
+
+// Redacted returns a copy of config in which the value of every field that
+// has the flatpack:"secret" field tag is replaced: strings by Mask and values
+// of any other type by their zero value. The copy is safe to log. Pointers to
+// nested structs are copied too, so config itself is never modified.
+//
+// The config may be a struct or a pointer to a struct; the result is of the
+// same type. Anything else is returned unchanged.
+func Redacted(config interface{}) interface{} {
+	v := reflect.ValueOf(config)
+	switch {
+	case v.Kind() == reflect.Struct:
+		return redactValue(v).Interface()
+	case v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Struct:
+		return redactValue(v).Interface()
+	}
+	return config
+}
+
+// Return a redacted copy of a struct or pointer.
+func redactValue(v reflect.Value) reflect.Value {
+	dup := reflect.New(v.Type()).Elem()
+	dup.Set(v)
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			dup = reflect.New(v.Type().Elem())
+			dup.Elem().Set(redactValue(v.Elem()))
+		}
+	case reflect.Struct:
+		fields, err := fieldsOf(Key{}, v.Type())
+		if err != nil {
+			// unexported fields; we can't produce a faithful copy, so
+			// err on the side of safety
+			return reflect.Zero(v.Type())
+		}
+		// copy embedded pointers, since promoted fields are redacted
+		// through them
+		for _, path := range embeddedPointers(v.Type(), fields) {
+			if value, ok := fieldByIndex(dup, path, false); ok && !value.IsNil() {
+				copied := reflect.New(value.Type().Elem())
+				copied.Elem().Set(value.Elem())
+				value.Set(copied)
+			}
+		}
+		for i := range fields {
+			field := &fields[i]
+			value, ok := fieldByIndex(dup, field.Index, false)
+			if !ok {
+				continue
+			}
+			if optionalElem(value.Type()) != nil {
+				// an Optional string keeps its mask, so it's still set
+				if _, set := optionalValue(value); set && parseTags(field).secret {
+					if target := optionalTarget(value); target.Kind() == reflect.String {
+						target.SetString(Mask)
+					} else {
+						value.Addr().Interface().(optional).reset()
+					}
+				}
+			} else if parseTags(field).secret {
+				if value.Kind() == reflect.String {
+					value.SetString(Mask)
+				} else {
+					value.Set(reflect.Zero(value.Type()))
+				}
+			} else if value.Kind() == reflect.Struct || value.Kind() == reflect.Ptr {
+				value.Set(redactValue(value))
+			}
+		}
+	}
+
+	return dup
+}
+
+// Remove a secret value from an error before it ends up in a log.
+func redactError(err error, secret string) error {
+	if err == nil || secret == "" {
+		return err
+	}
+
+	switch e := err.(type) {
+	case *BadValue:
+		redacted := *e
+		redacted.Cause = redactError(e.Cause, secret)
+		return &redacted
+	case *strconv.NumError:
+		return &strconv.NumError{Func: e.Func, Num: Mask, Err: e.Err}
+	}
+
+	if strings.Contains(err.Error(), secret) {
+		return errors.New(strings.ReplaceAll(err.Error(), secret, Mask))
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package flatpack
+
+import (
+	"bytes"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type secretive struct {
+	User     string
+	Password string `flatpack:"secret"`
+	PIN      int    `flatpack:"secret"`
+	Token    Secret
+	Database *struct {
+		Password string `flatpack:"secret"`
+	}
+}
+
+var _ = Describe("Secret", func() {
+	It("hides its value when formatted", func() {
+		s := Secret("hunter2")
+		Expect(s.String()).To(Equal(Mask))
+		Expect(fmt.Sprintf("%s %v %q %#v %d", s, s, s, s, s)).To(Equal("**** **** **** **** ****"))
+		Expect(fmt.Sprint(s)).To(Equal(Mask))
+		Expect(string(s)).To(Equal("hunter2"))
+	})
+})
+
+var _ = Describe("secret fields", func() {
+	It("are redacted from errors", func() {
+		env := map[string]string{"PIN": "hunter2"}
+		err := implementation{source: stubEnvironment(env)}.Unmarshal(&secretive{})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(MatchRegexp("malformed value"))
+		Expect(err.Error()).To(ContainSubstring(Mask))
+		Expect(err.Error()).NotTo(ContainSubstring("hunter2"))
+	})
+
+	It("are redacted from reports", func() {
+		env := map[string]string{
+			"USER":              "alice",
+			"PASSWORD":          "hunter2",
+			"TOKEN":             "t0k3n",
+			"DATABASE_PASSWORD": "s3cr3t",
+		}
+		got := secretive{}
+		report, err := implementation{source: stubEnvironment(env)}.UnmarshalWithReport(&got)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got.Password).To(Equal("hunter2"))
+		Expect(string(got.Token)).To(Equal("t0k3n"))
+		Expect(report[0].Raw).To(Equal("alice"))
+		for _, p := range report[1:] {
+			Expect(p.Raw).To(Equal(Mask))
+			Expect(p.Value).To(Equal(Mask))
+		}
+	})
+
+	It("are redacted from documentation", func() {
+		vars, err := Variables(secretive{Password: "hunter2"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vars[1].Default).To(Equal(Mask))
+		Expect(vars[1].Secret).To(BeTrue())
+
+		schema, err := Schema(secretive{Password: "hunter2"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(schema.Properties["PASSWORD"].Default).To(BeNil())
+
+		buf := bytes.Buffer{}
+		Expect(Document(&buf, secretive{Password: "hunter2"}, EnvExample)).To(Succeed())
+		Expect(buf.String()).To(ContainSubstring("\n# PASSWORD=\n"))
+		Expect(buf.String()).NotTo(ContainSubstring(Mask))
+	})
+
+	It("are still marshalled", func() {
+		env, err := Marshal(secretive{Password: "hunter2"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env["PASSWORD"]).To(Equal("hunter2"))
+	})
+})
+
+var _ = Describe("Redacted()", func() {
+	original := secretive{User: "alice", Password: "hunter2", PIN: 1234, Token: "t0k3n"}
+	original.Database = &struct {
+		Password string `flatpack:"secret"`
+	}{"s3cr3t"}
+
+	It("masks secret fields in a copy", func() {
+		redacted := Redacted(&original).(*secretive)
+		Expect(redacted.User).To(Equal("alice"))
+		Expect(redacted.Password).To(Equal(Mask))
+		Expect(redacted.PIN).To(Equal(0))
+		Expect(string(redacted.Token)).To(Equal(Mask))
+		Expect(redacted.Database.Password).To(Equal(Mask))
+
+		Expect(original.Password).To(Equal("hunter2"))
+		Expect(original.Database.Password).To(Equal("s3cr3t"))
+	})
+
+	It("accepts structs by value", func() {
+		redacted := Redacted(original).(secretive)
+		Expect(redacted.Password).To(Equal(Mask))
+	})
+
+	It("passes other values through", func() {
+		Expect(Redacted(42)).To(Equal(42))
+	})
+})
@@ -0,0 +1,175 @@
+package flatpack
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Options parsed from a field's flatpack struct tag. The tag is a comma-
+// separated list of options, some of which take a value:
+//
+//	Port     int     `flatpack:"required,desc=Port to listen on"`
+//	Host     string  `flatpack:"default=localhost"`
+//	Password string  `flatpack:"secret"`
+//	Conn     *sql.DB `flatpack:"ignore"`
+//	Level    string  `flatpack:"oneof=debug|info|warn"`
+//	Region   string  `flatpack:"alias=AWS_REGION|REGION"`
+//	Verbose  bool    `flatpack:"deprecated=use LEVEL instead"`
+//	Legacy   bool    `flatpack:"deprecated"`
+//
+// Option values may themselves contain commas; anything that does not look
+// like the start of a known option is treated as part of the previous
+// option's value if that option takes one. Otherwise it's a mistake, such as
+// a misspelled option, and the tag is malformed.
+type tags struct {
+	// ignore means the field isn't part of the configuration.
+	ignore bool
+	// required means the data source must supply a value for the field.
+	required bool
+	// hasDefault means def should be used if the data source has no value.
+	hasDefault bool
+	def        string
+	// desc is a human-readable description of the field.
+	desc string
+	// secret means the field's value must never be revealed in errors,
+	// reports or dumps. Fields of type Secret are always secret.
+	secret bool
+	// prefix means an embedded struct's type name is part of its fields'
+	// keys, rather than its fields being promoted.
+	prefix bool
+	// ignoreEmpty means a value that is set but empty counts as unset, as it
+	// does for fields that aren't strings or slices.
+	ignoreEmpty bool
+	// bytes means numbers may have units such as MiB; percent means a
+	// percentage such as 50% is stored as a fraction.
+	bytes, percent bool
+	// json means the whole field, whatever its type, is read from a single
+	// JSON document.
+	json bool
+	// aliases are the names of other variables that hold the field's value
+	// if its own isn't set, in order of preference.
+	aliases []string
+	// deprecated means the field's variables are on their way out;
+	// deprecation says what to do instead.
+	deprecated  bool
+	deprecation string
+	// rules constrain the values that may be read into the field.
+	rules []rule
+	// err records why the tag is malformed, if it is: an unknown option or
+	// the first rule that could not be parsed.
+	err error
+}
+
+// Names of the options that may appear in a flatpack tag, besides rules,
+// and whether they take a value.
+var tagOptions = map[string]bool{
+	"ignore":      false,
+	"required":    false,
+	"default":     true,
+	"desc":        true,
+	"secret":      false,
+	"prefix":      false,
+	"ignoreempty": false,
+	"bytes":       false,
+	"percent":     false,
+	"json":        false,
+	"alias":       true,
+	"deprecated":  true,
+}
+
+// Names of the options that take a value, but may be given without one.
+var optionalValues = map[string]bool{
+	"deprecated": true,
+}
+
+// Parse the flatpack tag of a struct field.
+func parseTags(field *reflect.StructField) tags {
+	result := tags{secret: isSecretType(field.Type)}
+	options, err := splitTag(field.Tag.Get("flatpack"))
+	result.err = err
+	for _, option := range options {
+		name, value := option[0], option[1]
+		switch name {
+		case "ignore":
+			result.ignore = true
+		case "required":
+			result.required = true
+		case "default":
+			result.hasDefault = true
+			result.def = value
+		case "desc":
+			result.desc = value
+		case "secret":
+			result.secret = true
+		case "prefix":
+			result.prefix = true
+		case "ignoreempty":
+			result.ignoreEmpty = true
+		case "bytes":
+			result.bytes = true
+		case "percent":
+			result.percent = true
+		case "json":
+			result.json = true
+		case "alias":
+			result.aliases = append(result.aliases, strings.Split(value, "|")...)
+		case "deprecated":
+			result.deprecated = true
+			result.deprecation = value
+		default:
+			r, err := newRule(name, value)
+			if err != nil && result.err == nil {
+				result.err = fmt.Errorf("%s: %s", r, err)
+			}
+			result.rules = append(result.rules, r)
+		}
+	}
+	return result
+}
+
+// Return a BadType if the tag of the named field, of the given kind, is
+// malformed, or nil if it is fine.
+func (t tags) malformed(name Key, kind reflect.Kind) error {
+	if t.err == nil {
+		return nil
+	}
+	return &BadType{Name: name, Kind: kind, reason: "malformed field tag; " + t.err.Error()}
+}
+
+// Split a tag into (name, value) pairs of known options. Anything else is
+// appended to the previous option's value if that option has one, and is an
+// error otherwise.
+func splitTag(tag string) ([][2]string, error) {
+	var options [][2]string
+	if tag == "" {
+		return options, nil
+	}
+	continues := false
+	for _, piece := range strings.Split(tag, ",") {
+		name, value, hasValue := strings.Cut(piece, "=")
+		takesValue, known := optionTakesValue(name)
+		switch {
+		case known && (takesValue == hasValue || takesValue && optionalValues[name]):
+			options = append(options, [2]string{name, value})
+			continues = hasValue
+		case continues:
+			options[len(options)-1][1] += "," + piece
+		case !known:
+			return options, fmt.Errorf("unknown option %q", name)
+		case hasValue:
+			return options, fmt.Errorf("%s doesn't take a value", name)
+		default:
+			return options, fmt.Errorf("%s needs a value", name)
+		}
+	}
+	return options, nil
+}
+
+// Determine whether name is a known option, and whether it takes a value.
+func optionTakesValue(name string) (takesValue, known bool) {
+	if takesValue, known = tagOptions[name]; !known {
+		takesValue, known = ruleOptions[name]
+	}
+	return
+}
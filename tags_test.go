@@ -0,0 +1,88 @@
+package flatpack
+
+import (
+	"reflect"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("parseTags()", func() {
+	parse := func(tag string) tags {
+		field := reflect.StructField{Name: "Foo", Type: reflect.TypeOf(""), Tag: reflect.StructTag(`flatpack:"` + tag + `"`)}
+		return parseTags(&field)
+	}
+
+	It("has a useful zero value", func() {
+		Expect(parse("")).To(Equal(tags{}))
+	})
+
+	It("parses flags", func() {
+		Expect(parse("ignore").ignore).To(BeTrue())
+		Expect(parse("required").required).To(BeTrue())
+		Expect(parse("secret").secret).To(BeTrue())
+	})
+
+	It("treats Secret fields as secret", func() {
+		field := reflect.StructField{Name: "Foo", Type: reflect.TypeOf([]*Secret{})}
+		Expect(parseTags(&field).secret).To(BeTrue())
+	})
+
+	It("parses values", func() {
+		t := parse("required,default=42,desc=The answer")
+		Expect(t.required).To(BeTrue())
+		Expect(t.hasDefault).To(BeTrue())
+		Expect(t.def).To(Equal("42"))
+		Expect(t.desc).To(Equal("The answer"))
+	})
+
+	It("distinguishes an empty default from no default", func() {
+		Expect(parse("default=").hasDefault).To(BeTrue())
+		Expect(parse("required").hasDefault).To(BeFalse())
+	})
+
+	It("allows commas in values", func() {
+		t := parse("desc=Host, port or socket,default=a,b,required")
+		Expect(t.desc).To(Equal("Host, port or socket"))
+		Expect(t.def).To(Equal("a,b"))
+		Expect(t.required).To(BeTrue())
+	})
+
+	It("parses rules", func() {
+		t := parse("required,min=1,pattern=^a{1,2}$,oneof=a|aa")
+		Expect(t.required).To(BeTrue())
+		Expect(t.err).NotTo(HaveOccurred())
+		Expect(t.rules).To(HaveLen(3))
+		Expect(t.rules[0].String()).To(Equal("min=1"))
+		Expect(t.rules[1].String()).To(Equal("pattern=^a{1,2}$"))
+		Expect(t.rules[2].String()).To(Equal("oneof=a|aa"))
+	})
+
+	It("records malformed rules", func() {
+		Expect(parse("pattern=(").err).To(HaveOccurred())
+	})
+
+	It("parses deprecated with or without advice", func() {
+		for _, tag := range []string{"deprecated", "deprecated=", "required,deprecated"} {
+			t := parse(tag)
+			Expect(t.err).NotTo(HaveOccurred())
+			Expect(t.deprecated).To(BeTrue())
+			Expect(t.deprecation).To(BeEmpty())
+		}
+		Expect(parse("deprecated=use A, or B").deprecation).To(Equal("use A, or B"))
+		Expect(parse("deprecated,bogus").err).To(MatchError(`unknown option "bogus"`))
+	})
+
+	It("rejects unknown options", func() {
+		Expect(parse("requried").err).To(MatchError(`unknown option "requried"`))
+		Expect(parse("secret,defualt=x").err).To(MatchError(`unknown option "defualt"`))
+		Expect(parse("required=true").err).To(MatchError("required doesn't take a value"))
+		Expect(parse("default").err).To(MatchError("default needs a value"))
+	})
+
+	It("only joins pieces to options that take a value", func() {
+		t := parse("desc=a,bogus")
+		Expect(t.err).NotTo(HaveOccurred())
+		Expect(t.desc).To(Equal("a,bogus"))
+	})
+})
@@ -107,4 +107,29 @@ var _ = Describe("Unmarshal()", func() {
 			Expect(Unmarshal(&got3)).To(HaveOccurred())
 		})
 	})
+
+	Context("given a case-insensitive data source", func() {
+		getter := caseInsensitive([]string{
+			"email=carol@example.com",
+			"Age=36",
+			"AGE=37",
+			"age=38",
+			"family_mother=Alice",
+			"=C:=C:\\",
+			"superstitious",
+		})
+
+		It("ignores the case of variable names", func() {
+			got := person{}
+			Expect(New(getter).Unmarshal(&got)).To(Succeed())
+			Expect(got.Email).To(Equal("carol@example.com"))
+			Expect(got.Age).To(Equal(uint(37)))
+			Expect(got.Family).To(Equal(&family{Mother: "Alice"}))
+
+			value, ok, err := getter.Lookup(Key{"Superstitious"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(value).To(BeEmpty())
+		})
+	})
 })
@@ -1,18 +1,45 @@
 package flatpack
 
-// unmarshaller represents an object that is capable of unmarshalling
+import "context"
+
+// Unmarshaller represents an object that is capable of unmarshalling
 // configuration data into destination structures. It encapsulates the
-// source of the data as well as any options pertaining to data ccess.
-//
-// TODO: export this in order to provide a non-singleton interface to flatpack
-type unmarshaller interface {
+// source of the data as well as any options pertaining to data access.
+type Unmarshaller interface {
 	// Unmarshal reads configuration data from some source into a struct.
 	Unmarshal(dest interface{}) error
+
+	// UnmarshalContext reads configuration data into a struct, passing ctx
+	// to validaters.
+	UnmarshalContext(ctx context.Context, dest interface{}) error
+
+	// UnmarshalWithReport reads configuration data into a struct and
+	// reports where each value came from.
+	UnmarshalWithReport(dest interface{}) (Report, error)
+
+	// Watch reads configuration data into a struct and then publishes a
+	// reloaded copy whenever the source changes.
+	Watch(ctx context.Context, dest interface{}, onChange func(old, new interface{})) (*Watcher, error)
+}
+
+// Option customizes the behavior of an Unmarshaller.
+type Option func(*implementation)
+
+// New constructs an Unmarshaller for the given data source. This is the
+// non-singleton interface to flatpack, for applications that need more than
+// one data source or want to set options.
+func New(source Getter, opts ...Option) Unmarshaller {
+	f := &implementation{source: source}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
 }
 
-// Construct an unmarshaller for the given data source.
-//
-// TODO: export this in order to provide a non-singleton interface to flatpack
-func new(source Getter) unmarshaller {
-	return &implementation{source}
+// WithSource makes an Unmarshaller read from the given data source instead
+// of the one it was constructed with. It is mostly useful with Load.
+func WithSource(source Getter) Option {
+	return func(f *implementation) {
+		f.source = source
+	}
 }
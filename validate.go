@@ -0,0 +1,225 @@
+package flatpack
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A constraint on the value of a field, declared with a field tag such as
+// flatpack:"min=1,max=65535".
+//
+// Scalar fields are checked against every rule. Slice fields are checked
+// against min, max and nonempty as a whole, i.e. against their length; the
+// remaining rules are applied to every element, including the elements of
+// nested slices.
+type rule struct {
+	name, arg string
+	// check returns true if the value satisfies the rule
+	check func(value reflect.Value) bool
+	// match, if not nil, is equivalent to check but takes the formatted value
+	match func(value string) bool
+	// length is true if check applies to the length of slices
+	length bool
+}
+
+func (r rule) String() string {
+	if r.arg == "" {
+		return r.name
+	}
+	return r.name + "=" + r.arg
+}
+
+// Names of the options that declare rules, and whether they take a value.
+var ruleOptions = map[string]bool{
+	"min":      true,
+	"max":      true,
+	"oneof":    true,
+	"pattern":  true,
+	"nonempty": false,
+	"url":      false,
+	"hostname": false,
+	"email":    false,
+}
+
+// Construct a rule from a tag option.
+func newRule(name, arg string) (rule, error) {
+	r := rule{name: name, arg: arg}
+	switch name {
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return r, err
+		}
+		cmp := func(n float64) bool { return n >= limit }
+		if name == "max" {
+			cmp = func(n float64) bool { return n <= limit }
+		}
+		r.length = true
+		r.check = func(value reflect.Value) bool {
+			switch value.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				return cmp(float64(value.Int()))
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+				reflect.Uint64, reflect.Uintptr:
+				return cmp(float64(value.Uint()))
+			case reflect.Float32, reflect.Float64:
+				return cmp(value.Float())
+			case reflect.String, reflect.Slice:
+				return cmp(float64(value.Len()))
+			}
+			return true
+		}
+	case "nonempty":
+		r.length = true
+		r.check = func(value reflect.Value) bool {
+			switch value.Kind() {
+			case reflect.String, reflect.Slice:
+				return value.Len() > 0
+			}
+			return true
+		}
+	case "oneof":
+		choices := strings.Split(arg, "|")
+		r.match = func(value string) bool {
+			for _, choice := range choices {
+				if value == choice {
+					return true
+				}
+			}
+			return false
+		}
+	case "pattern":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return r, err
+		}
+		r.match = re.MatchString
+	case "url":
+		r.match = func(value string) bool {
+			u, err := url.Parse(value)
+			return err == nil && u.Scheme != "" && (u.Host != "" || u.Opaque != "")
+		}
+	case "hostname":
+		r.match = isHostname
+	case "email":
+		r.match = func(value string) bool {
+			address, err := mail.ParseAddress(value)
+			return err == nil && address.Address == value
+		}
+	default:
+		return r, fmt.Errorf("unknown rule %s", name)
+	}
+	if match := r.match; match != nil {
+		r.check = func(value reflect.Value) bool {
+			return match(format(value))
+		}
+	}
+	return r, nil
+}
+
+// Check a value that has just been read against the field's rules.
+func (f implementation) check(name Key, tags tags, value reflect.Value) error {
+	for _, r := range tags.rules {
+		if value.Kind() != reflect.Slice || r.length {
+			if !r.check(value) {
+				return &InvalidValue{Name: name, Rule: r.String()}
+			}
+		} else if !r.checkElems(value) {
+			return &InvalidValue{Name: name, Rule: r.String()}
+		}
+	}
+	return nil
+}
+
+// Check every element of a slice against a rule, and every element of the
+// slices nested in it.
+func (r rule) checkElems(value reflect.Value) bool {
+	for i := 0; i < value.Len(); i++ {
+		elem := value.Index(i)
+		if elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if optionalElem(elem.Type()) != nil {
+			var set bool
+			if elem, set = optionalValue(elem); !set {
+				continue
+			}
+		}
+		if elem.Kind() == reflect.Slice {
+			if !r.checkElems(elem) {
+				return false
+			}
+		} else if !r.check(elem) {
+			return false
+		}
+	}
+	return true
+}
+
+// Determine whether a string is a valid RFC 1123 host name.
+func isHostname(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, char := range label {
+			if !(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' ||
+				char >= '0' && char <= '9' || char == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Call the Validate or ValidateContext method of a value that has just been
+// populated, if it has one. Errors are wrapped in a ValidationFailed that
+// records the key of the value, except for the top-level struct.
+func (f implementation) validate(name Key, value reflect.Value) error {
+	var target interface{}
+	if value.CanAddr() {
+		target = value.Addr().Interface()
+	} else {
+		target = value.Interface()
+	}
+
+	return callValidater(f.contextOrBackground(), f.source, name, target)
+}
+
+// Call the Validate or ValidateContext method of target, if it has one, on
+// behalf of validate() or generated code.
+func callValidater(ctx context.Context, source Getter, name Key, target interface{}) error {
+	var err error
+	switch validater := target.(type) {
+	case ContextValidater:
+		err = validater.ValidateContext(context.WithValue(ctx, sourceKey{}, source), name)
+	case Validater:
+		err = validater.Validate()
+	}
+
+	if err != nil && len(name) > 0 {
+		err = &ValidationFailed{Name: name, Cause: err}
+	}
+	return err
+}
+
+// Context key under which validate() stores the data source.
+type sourceKey struct{}
+
+// SourceFromContext returns the data source that is being unmarshalled
+// from, when called with the context passed to a ContextValidater. This
+// allows validaters to consult other configuration values.
+func SourceFromContext(ctx context.Context) (Getter, bool) {
+	source, ok := ctx.Value(sourceKey{}).(Getter)
+	return source, ok
+}
@@ -0,0 +1,216 @@
+package flatpack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type constrained struct {
+	Port    int      `flatpack:"min=1,max=65535"`
+	Ratio   float64  `flatpack:"min=0,max=1"`
+	Level   string   `flatpack:"oneof=debug|info|warn"`
+	Name    string   `flatpack:"pattern=^[a-z]{2,8}$"`
+	Hosts   []string `flatpack:"nonempty,max=2,hostname"`
+	Codes   []int    `flatpack:"oneof=200|404"`
+	Website string   `flatpack:"url"`
+	Contact string   `flatpack:"email"`
+}
+
+type malformedRule struct {
+	Port int `flatpack:"min=one"`
+}
+
+type misspelledOption struct {
+	Port int `flatpack:"requried"`
+}
+
+var _ = Describe("validation rules", func() {
+	valid := map[string]string{
+		"PORT":    "8080",
+		"RATIO":   "0.5",
+		"LEVEL":   "info",
+		"NAME":    "app",
+		"HOSTS":   `["db1.example.com", "localhost"]`,
+		"CODES":   "[200,404]",
+		"WEBSITE": "https://example.com/path",
+		"CONTACT": "ops@example.com",
+	}
+
+	unmarshal := func(overrides map[string]string) error {
+		env := map[string]string{}
+		for k, v := range valid {
+			env[k] = v
+		}
+		for k, v := range overrides {
+			env[k] = v
+		}
+		return implementation{source: stubEnvironment(env)}.Unmarshal(&constrained{})
+	}
+
+	It("accepts valid values", func() {
+		Expect(unmarshal(nil)).To(Succeed())
+	})
+
+	It("does not check values that are not set", func() {
+		Expect(implementation{source: stubEnvironment(nil)}.Unmarshal(&constrained{})).To(Succeed())
+	})
+
+	invalid := []struct{ key, value, rule string }{
+		{"PORT", "0", "min=1"},
+		{"PORT", "65536", "max=65535"},
+		{"RATIO", "1.5", "max=1"},
+		{"LEVEL", "trace", "oneof=debug|info|warn"},
+		{"NAME", "App", "pattern=^[a-z]{2,8}$"},
+		{"HOSTS", "[]", "nonempty"},
+		{"HOSTS", `["a","b","c"]`, "max=2"},
+		{"HOSTS", `["-bad-"]`, "hostname"},
+		{"CODES", "[200,500]", "oneof=200|404"},
+		{"WEBSITE", "example.com", "url"},
+		{"CONTACT", "Ops <ops@example.com>", "email"},
+	}
+	for _, c := range invalid {
+		c := c
+		It("rejects values that violate "+c.rule, func() {
+			err := unmarshal(map[string]string{c.key: c.value})
+			Expect(err).To(HaveOccurred())
+			invalid := &InvalidValue{}
+			Expect(errors.As(err, &invalid)).To(BeTrue())
+			Expect(invalid.Name.AsEnv()).To(Equal(c.key))
+			Expect(invalid.Rule).To(Equal(c.rule))
+		})
+	}
+
+	It("aggregates errors", func() {
+		err := unmarshal(map[string]string{"PORT": "0", "LEVEL": "trace", "RATIO": "oops"})
+		Expect(err).To(BeAssignableToTypeOf(Errors{}))
+		Expect(err.(Errors)).To(HaveLen(3))
+		Expect(err.Error()).To(MatchRegexp(`must satisfy min=1 \(name=Port\); flatpack: malformed value.*name=Ratio.*; .*oneof`))
+	})
+
+	It("complains about malformed rules", func() {
+		env := map[string]string{"PORT": "80"}
+		err := implementation{source: stubEnvironment(env)}.Unmarshal(&malformedRule{})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(MatchRegexp("malformed field tag; min=one"))
+	})
+
+	It("complains about malformed rules of fields that aren't set", func() {
+		err := implementation{source: stubEnvironment(map[string]string{})}.Unmarshal(&malformedRule{})
+		Expect(err).To(MatchError(MatchRegexp("malformed field tag; min=one")))
+
+		_, err = Schema(&malformedRule{})
+		Expect(err).To(MatchError(MatchRegexp("malformed field tag; min=one")))
+	})
+
+	It("complains about misspelled options", func() {
+		err := implementation{source: stubEnvironment(map[string]string{"PORT": "80"})}.Unmarshal(&misspelledOption{})
+		Expect(err).To(MatchError(MatchRegexp(`malformed field tag; unknown option "requried" \(name=Port,`)))
+	})
+})
+
+var _ = Describe("isHostname()", func() {
+	It("follows RFC 1123", func() {
+		Expect(isHostname("localhost")).To(BeTrue())
+		Expect(isHostname("db-1.example.com.")).To(BeTrue())
+		Expect(isHostname("")).To(BeFalse())
+		Expect(isHostname("a..b")).To(BeFalse())
+		Expect(isHostname("under_score")).To(BeFalse())
+		Expect(isHostname("-leading")).To(BeFalse())
+	})
+})
+
+// For testing per-field Validater calls
+type evenNumber int
+
+func (n evenNumber) Validate() error {
+	if n%2 != 0 {
+		return errors.New("odd number")
+	}
+	return nil
+}
+
+type validatedSection struct {
+	Host string
+}
+
+func (s *validatedSection) Validate() error {
+	if s.Host == "" {
+		return errors.New("no host")
+	}
+	return nil
+}
+
+type strictKey struct{}
+
+type contextSection struct {
+	Port int
+}
+
+func (s *contextSection) ValidateContext(ctx context.Context, name Key) error {
+	source, ok := SourceFromContext(ctx)
+	if !ok {
+		return errors.New("no source")
+	}
+	limit, _ := source.Get(Key{"Limit"})
+	if ctx.Value(strictKey{}) != nil && limit != "" {
+		return fmt.Errorf("%s: port limited to %s", name, limit)
+	}
+	return nil
+}
+
+func (s *contextSection) Validate() error {
+	panic("should not be called")
+}
+
+type validatedParent struct {
+	Number   evenNumber
+	Numbers  *evenNumber
+	Section  validatedSection
+	Optional *validatedSection
+	Context  contextSection
+}
+
+var _ = Describe("Validater", func() {
+	unmarshal := func(env map[string]string) error {
+		return implementation{source: stubEnvironment(env)}.Unmarshal(&validatedParent{})
+	}
+
+	It("is called for nested structs and custom types", func() {
+		Expect(unmarshal(map[string]string{"SECTION_HOST": "a", "NUMBER": "2"})).To(Succeed())
+	})
+
+	It("is not called for pointers that are left nil", func() {
+		Expect(unmarshal(map[string]string{"SECTION_HOST": "a"})).To(Succeed())
+
+		// an empty value is a value, so the pointer is kept
+		err := unmarshal(map[string]string{"SECTION_HOST": "a", "OPTIONAL_HOST": ""})
+		Expect(err).To(MatchError(&ValidationFailed{Name: Key{"Optional"}, Cause: errors.New("no host")}))
+	})
+
+	It("reports failures with their key", func() {
+		err := unmarshal(map[string]string{"NUMBER": "3", "NUMBERS": "5"})
+		Expect(err).To(HaveOccurred())
+		Expect(err.(Errors)).To(HaveLen(3))
+
+		failed := &ValidationFailed{}
+		Expect(errors.As(err, &failed)).To(BeTrue())
+		Expect(failed.Name).To(Equal(Key{"Number"}))
+		Expect(failed.Cause).To(MatchError("odd number"))
+		Expect(err.Error()).To(ContainSubstring(`validation failed; (name=Numbers,cause="odd number")`))
+		Expect(err.Error()).To(ContainSubstring(`validation failed; (name=Section,cause="no host")`))
+	})
+
+	It("passes a context to ContextValidaters", func() {
+		env := map[string]string{"SECTION_HOST": "a", "LIMIT": "1024"}
+		it := implementation{source: stubEnvironment(env)}
+		Expect(it.Unmarshal(&validatedParent{})).To(Succeed())
+
+		ctx := context.WithValue(context.Background(), strictKey{}, true)
+		err := it.UnmarshalContext(ctx, &validatedParent{})
+		Expect(err).To(MatchError(`flatpack: validation failed; (name=Context,cause="Context: port limited to 1024")`))
+	})
+})
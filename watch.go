@@ -0,0 +1,218 @@
+package flatpack
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// Watchable represents a Getter that can tell when its data may have
+// changed, e.g. by observing a file's modification time or long-polling
+// an HTTP k/v store.
+type Watchable interface {
+	Getter
+	// Changes returns a channel that receives a value whenever the data
+	// may have changed. The channel is closed when ctx is done.
+	Changes(ctx context.Context) <-chan struct{}
+}
+
+// WatchInterval is how often Watch polls data sources that do not implement
+// Watchable.
+var WatchInterval = 30 * time.Second
+
+// Watch reads configuration data from the package's DataSource into a struct,
+// then keeps watching the DataSource and publishes a reloaded copy of the
+// struct whenever its data changes.
+//
+// See Unmarshaller.Watch for details.
+func Watch(ctx context.Context, dest interface{}, onChange func(old, new interface{})) (*Watcher, error) {
+	return New(DataSource).Watch(ctx, dest, onChange)
+}
+
+// Watcher holds the latest good configuration loaded by Watch.
+type Watcher struct {
+	current atomic.Value
+	// base is a copy of dest as it was before the first Unmarshal, which
+	// every reload starts from
+	base reflect.Value
+	errs chan error
+}
+
+// Load returns a pointer to the current configuration, which has the same
+// type as the dest that was passed to Watch and is dest itself until the
+// first change. It is safe to call from any goroutine. The configuration it
+// points to is never modified by flatpack, and must not be modified by the
+// caller either.
+func (w *Watcher) Load() interface{} {
+	return w.current.Load()
+}
+
+// Errors returns a channel that receives the errors of reloads that failed.
+// It holds only the latest error that hasn't been received, so reloads go on
+// whether or not anybody receives from it. It is closed when the context
+// passed to Watch is done.
+func (w *Watcher) Errors() <-chan error {
+	return w.errs
+}
+
+// Send an error to the Errors channel without blocking, replacing the one
+// that is waiting there, if any. Only the watch goroutine may call this.
+func (w *Watcher) report(err error) {
+	for {
+		select {
+		case w.errs <- err:
+			return
+		default:
+		}
+		select {
+		case <-w.errs:
+		default:
+		}
+	}
+}
+
+// Watch unmarshals into dest and then starts a goroutine that reloads the
+// configuration whenever the data source changes. If the source implements
+// Watchable, it is asked for change notifications; otherwise it is polled
+// every WatchInterval.
+//
+// Each reload unmarshals into a deep copy of dest as it was before Watch was
+// called, which is validated as usual; fields that the source doesn't provide
+// keep the values they had then, even if the source provided them earlier.
+// Only if that succeeds, and the result differs from the current
+// configuration, is the copy published: it replaces the current configuration
+// of the returned Watcher in a single atomic step, after which onChange is
+// called with pointers to the old and new configurations. If the reload
+// fails, the current configuration is kept and the error is sent to the
+// Watcher's Errors channel, which nobody has to receive from.
+//
+// dest itself is only written before Watch returns; read later
+// configurations from Watcher.Load or onChange.
+func (f implementation) Watch(ctx context.Context, dest interface{}, onChange func(old, new interface{})) (*Watcher, error) {
+	var base reflect.Value
+	if v := reflect.ValueOf(dest); v.Kind() == reflect.Ptr && !v.IsNil() {
+		base = clone(v.Elem())
+	}
+	if err := f.Unmarshal(dest); err != nil {
+		return nil, err
+	}
+
+	var changes <-chan struct{}
+	if watchable, ok := f.source.(Watchable); ok {
+		changes = watchable.Changes(ctx)
+	} else {
+		changes = poll(ctx, WatchInterval)
+	}
+
+	w := &Watcher{base: base, errs: make(chan error, 1)}
+	w.current.Store(dest)
+	go func() {
+		defer close(w.errs)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-changes:
+				if !ok {
+					return
+				}
+			}
+			if err := f.reload(w, onChange); err != nil {
+				w.report(err)
+			}
+		}
+	}()
+
+	return w, nil
+}
+
+// Unmarshal into a copy of the original configuration and, if successful and
+// different from the current one, publish the copy.
+func (f implementation) reload(w *Watcher, onChange func(old, new interface{})) error {
+	old := w.Load()
+	current := reflect.ValueOf(old).Elem()
+	fresh := reflect.New(current.Type())
+	fresh.Elem().Set(clone(w.base))
+	if err := f.Unmarshal(fresh.Interface()); err != nil {
+		return err
+	}
+	if reflect.DeepEqual(current.Interface(), fresh.Elem().Interface()) {
+		return nil
+	}
+
+	w.current.Store(fresh.Interface())
+	if onChange != nil {
+		onChange(old, fresh.Interface())
+	}
+	return nil
+}
+
+// Make a deep copy of v, so that unmarshalling into the copy can't modify
+// anything that v refers to. Unexported fields are copied as they are, except
+// for the value of an Optional.
+func clone(v reflect.Value) reflect.Value {
+	out := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			out.Set(reflect.New(v.Type().Elem()))
+			out.Elem().Set(clone(v.Elem()))
+		}
+	case reflect.Slice:
+		if !v.IsNil() {
+			out.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				out.Index(i).Set(clone(v.Index(i)))
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(clone(v.Index(i)))
+		}
+	case reflect.Map:
+		if !v.IsNil() {
+			out.Set(reflect.MakeMapWithSize(v.Type(), v.Len()))
+			for it := v.MapRange(); it.Next(); {
+				out.SetMapIndex(it.Key(), clone(it.Value()))
+			}
+		}
+	case reflect.Struct:
+		out.Set(v)
+		if _, ok := out.Addr().Interface().(optional); ok {
+			target := optionalTarget(out)
+			target.Set(clone(target))
+		}
+		for i := 0; i < out.NumField(); i++ {
+			if field := out.Field(i); field.CanSet() {
+				field.Set(clone(field))
+			}
+		}
+	default:
+		out.Set(v)
+	}
+	return out
+}
+
+// Produce a change notification at regular intervals until ctx is done.
+func poll(ctx context.Context, interval time.Duration) <-chan struct{} {
+	changes := make(chan struct{})
+	go func() {
+		defer close(changes)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				select {
+				case changes <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return changes
+}
@@ -0,0 +1,274 @@
+package flatpack
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// A Getter whose data can be changed by the test, which announces changes to
+// anyone who is watching.
+type mutableEnvironment struct {
+	lock    sync.Mutex
+	pairs   map[string]string
+	changes chan struct{}
+}
+
+func (me *mutableEnvironment) Get(name Key) (string, error) {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+	return me.pairs[name.AsEnv()], nil
+}
+
+func (me *mutableEnvironment) Changes(ctx context.Context) <-chan struct{} {
+	return me.changes
+}
+
+func (me *mutableEnvironment) set(key, value string) {
+	me.lock.Lock()
+	me.pairs[key] = value
+	me.lock.Unlock()
+	me.changes <- struct{}{}
+}
+
+func (me *mutableEnvironment) unset(key string) {
+	me.lock.Lock()
+	delete(me.pairs, key)
+	me.lock.Unlock()
+	me.changes <- struct{}{}
+}
+
+type watched struct {
+	Port int
+	Host string `flatpack:"ignore"`
+	Tags *watchedTags
+}
+
+type watchedTags struct {
+	Names []string
+}
+
+func (w *watched) Validate() error {
+	if w.Port > 65535 {
+		return errors.New("port out of range")
+	}
+	return nil
+}
+
+var _ = Describe("Watch()", func() {
+	var env *mutableEnvironment
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	BeforeEach(func() {
+		env = &mutableEnvironment{
+			pairs:   map[string]string{"PORT": "80"},
+			changes: make(chan struct{}),
+		}
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() { cancel() })
+
+	It("loads the initial configuration", func() {
+		cfg := watched{}
+		_, err := implementation{source: env}.Watch(ctx, &cfg, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Port).To(Equal(80))
+	})
+
+	It("reports initial errors synchronously", func() {
+		env.pairs["PORT"] = "99999"
+		cfg := watched{}
+		w, err := implementation{source: env}.Watch(ctx, &cfg, nil)
+		Expect(err).To(MatchError("port out of range"))
+		Expect(w).To(BeNil())
+	})
+
+	It("swaps in valid updates", func() {
+		cfg := watched{}
+		updates := make(chan [2]int, 1)
+		onChange := func(old, new interface{}) {
+			updates <- [2]int{old.(*watched).Port, new.(*watched).Port}
+		}
+		w, err := implementation{source: env}.Watch(ctx, &cfg, onChange)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Load()).To(BeIdenticalTo(&cfg))
+
+		env.set("PORT", "8080")
+		Eventually(updates).Should(Receive(Equal([2]int{80, 8080})))
+		Expect(w.Load().(*watched).Port).To(Equal(8080))
+		Expect(cfg.Port).To(Equal(80))
+	})
+
+	It("keeps fields that the source doesn't provide", func() {
+		cfg := watched{Host: "localhost"}
+		updates := make(chan *watched, 1)
+		w, err := implementation{source: env}.Watch(ctx, &cfg, func(old, new interface{}) {
+			updates <- new.(*watched)
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		env.changes <- struct{}{}
+		env.set("PORT", "8080")
+		var got *watched
+		Eventually(updates).Should(Receive(&got))
+		Expect(*got).To(Equal(watched{Port: 8080, Host: "localhost"}))
+		Expect(w.Load()).To(BeIdenticalTo(got))
+		Consistently(updates).ShouldNot(Receive())
+	})
+
+	It("restores the original values of keys that are removed", func() {
+		env.pairs["TAGS_NAMES"] = `["a"]`
+		cfg := watched{Port: 1}
+		updates := make(chan *watched, 1)
+		w, err := implementation{source: env}.Watch(ctx, &cfg, func(old, new interface{}) {
+			updates <- new.(*watched)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Port).To(Equal(80))
+
+		env.set("PORT", "8080")
+		Eventually(updates).Should(Receive())
+		env.unset("PORT")
+		var got *watched
+		Eventually(updates).Should(Receive(&got))
+		Expect(got.Port).To(Equal(1))
+		Expect(got.Tags.Names).To(Equal([]string{"a"}))
+
+		env.unset("TAGS_NAMES")
+		Eventually(updates).Should(Receive(&got))
+		Expect(*got).To(Equal(watched{Port: 1}))
+		Expect(w.Load()).To(BeIdenticalTo(got))
+	})
+
+	It("doesn't modify configurations it has published", func() {
+		env.pairs["TAGS_NAMES"] = `["a"]`
+		cfg := watched{}
+		updates := make(chan *watched, 1)
+		w, err := implementation{source: env}.Watch(ctx, &cfg, func(old, new interface{}) {
+			updates <- new.(*watched)
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		env.set("TAGS_NAMES", `["b"]`)
+		Eventually(updates).Should(Receive())
+		Expect(cfg.Tags.Names).To(Equal([]string{"a"}))
+		Expect(w.Load().(*watched).Tags.Names).To(Equal([]string{"b"}))
+	})
+
+	It("rejects invalid updates", func() {
+		cfg := watched{}
+		called := false
+		w, err := implementation{source: env}.Watch(ctx, &cfg, func(old, new interface{}) { called = true })
+		Expect(err).NotTo(HaveOccurred())
+
+		env.set("PORT", "99999")
+		Eventually(w.Errors()).Should(Receive(MatchError("port out of range")))
+		Expect(w.Load().(*watched).Port).To(Equal(80))
+		Expect(called).To(BeFalse())
+	})
+
+	It("keeps reloading when nobody receives errors", func() {
+		cfg := watched{}
+		updates := make(chan int, 1)
+		w, err := implementation{source: env}.Watch(ctx, &cfg, func(old, new interface{}) {
+			updates <- new.(*watched).Port
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		env.set("PORT", "99999")
+		env.set("PORT", "100000")
+		env.set("PORT", "8080")
+		Eventually(updates).Should(Receive(Equal(8080)))
+		Expect(w.Errors()).To(Receive(MatchError("port out of range")))
+		Expect(w.Errors()).NotTo(Receive())
+	})
+
+	It("closes the error channel when the context is done", func() {
+		cfg := watched{}
+		w, err := implementation{source: env}.Watch(ctx, &cfg, nil)
+		Expect(err).NotTo(HaveOccurred())
+		cancel()
+		Eventually(w.Errors()).Should(BeClosed())
+	})
+
+	It("polls sources that are not Watchable", func() {
+		saved := WatchInterval
+		WatchInterval = time.Millisecond
+		defer func() { WatchInterval = saved }()
+
+		pairs := map[string]string{"PORT": "80"}
+		lock := sync.Mutex{}
+		source := processEnvironment{func(key string) (string, bool) {
+			lock.Lock()
+			defer lock.Unlock()
+			value, ok := pairs[key]
+			return value, ok
+		}}
+
+		cfg := watched{}
+		updates := make(chan int, 1)
+		_, err := implementation{source: source}.Watch(ctx, &cfg, func(old, new interface{}) {
+			updates <- new.(*watched).Port
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		lock.Lock()
+		pairs["PORT"] = "443"
+		lock.Unlock()
+		Eventually(updates).Should(Receive(Equal(443)))
+	})
+
+	It("polls through a Cache of sources that are not Watchable", func() {
+		saved := WatchInterval
+		WatchInterval = time.Millisecond
+		defer func() { WatchInterval = saved }()
+
+		pairs := map[string]string{"PORT": "80"}
+		lock := sync.Mutex{}
+		source := processEnvironment{func(key string) (string, bool) {
+			lock.Lock()
+			defer lock.Unlock()
+			value, ok := pairs[key]
+			return value, ok
+		}}
+
+		for _, ttl := range []time.Duration{0, time.Hour} {
+			cfg := watched{}
+			updates := make(chan int, 1)
+			ctx, cancel := context.WithCancel(ctx)
+			_, err := implementation{source: NewCache(source, ttl)}.Watch(ctx, &cfg, func(old, new interface{}) {
+				updates <- new.(*watched).Port
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			lock.Lock()
+			pairs["PORT"] = "443"
+			lock.Unlock()
+			Eventually(updates).Should(Receive(Equal(443)))
+			cancel()
+
+			lock.Lock()
+			pairs["PORT"] = "80"
+			lock.Unlock()
+		}
+	})
+
+	It("forwards changes through a Cache", func() {
+		cache := NewCache(env, 0)
+		cfg := watched{}
+		updates := make(chan int, 1)
+		_, err := implementation{source: cache}.Watch(ctx, &cfg, func(old, new interface{}) {
+			updates <- new.(*watched).Port
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		env.set("PORT", "8443")
+		Eventually(updates).Should(Receive(Equal(8443)))
+	})
+})